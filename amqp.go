@@ -0,0 +1,132 @@
+package logspoutRancher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// amqpSink publishes events to an exchange with a routing key rendered
+// from their metadata, waiting for the publisher confirms of each batch
+type amqpSink struct {
+	url        string
+	exchange   string
+	routingKey *template.Template
+	timeout    time.Duration
+	conn       *amqp.Connection
+	channel    *amqp.Channel
+	mutex      sync.Mutex
+}
+
+// NewAMQPAdapter creates an adapter publishing to amqp://rabbitmq:5672/vhost,
+// or amqp+tls for TLS
+func NewAMQPAdapter(route *router.Route) (router.LogAdapter, error) {
+	scheme := "amqp"
+	if route.AdapterTransport("") == "tls" {
+		scheme = "amqps"
+	}
+	address := &url.URL{Scheme: scheme, Host: route.Address}
+	if user := getStringParameter(route.Options, "amqp.user", ""); user != "" {
+		address.User = url.UserPassword(user, secretParameter(route.Options, "amqp.password", "AMQP_PASSWORD"))
+	}
+	if vhost := getStringParameter(route.Options, "amqp.vhost", ""); vhost != "" {
+		address.Path = "/" + vhost
+	}
+
+	s := &amqpSink{
+		url:        address.String(),
+		exchange:   getStringParameter(route.Options, "amqp.exchange", "logs"),
+		routingKey: parseTemplate("amqp.routing_key", getStringParameter(route.Options, "amqp.routing_key", "{{.Stack}}.{{.Service}}")),
+		timeout:    getDurationParameter(route.Options, "amqp.timeout", 10*time.Second),
+	}
+	if err := s.connect(); err != nil {
+		debug("amqp: cannot connect, will retry:", err)
+	}
+	debug("amqp:", route.Address, "exchange:", s.exchange)
+
+	adapter := newAdapter(route)
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Connect and open a channel in confirm mode
+func (s *amqpSink) connect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.channel = nil, nil
+	}
+
+	conn, err := amqp.Dial(s.url)
+	if err != nil {
+		return err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return err
+	}
+	s.conn, s.channel = conn, channel
+
+	return nil
+}
+
+// Publish the batch and wait for the broker to confirm every event, the
+// connection is re-established before the batch is retried
+func (s *amqpSink) send(buffer []*map[string]interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.channel == nil || s.channel.IsClosed() {
+		if err := s.connect(); err != nil {
+			return fmt.Errorf("cannot connect: %s", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var confirms []*amqp.DeferredConfirmation
+	for _, data := range buffer {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		confirm, err := s.channel.PublishWithDeferredConfirmWithContext(ctx, s.exchange,
+			renderTemplate(s.routingKey, *data), false, false, amqp.Publishing{
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				Body:         payload,
+			})
+		if err != nil {
+			s.connect()
+			return fmt.Errorf("error on publish: %s", err)
+		}
+		confirms = append(confirms, confirm)
+	}
+
+	for _, confirm := range confirms {
+		acked, err := confirm.WaitContext(ctx)
+		if err != nil {
+			return fmt.Errorf("publish not confirmed: %s", err)
+		}
+		if !acked {
+			return fmt.Errorf("publish rejected by the broker")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reasons recorded in the audit trail for dropped messages
+const (
+	dropFiltered     = "filtered"
+	dropFailed       = "failed"
+	dropQuota        = "quota"
+	dropMemory       = "memory"
+	dropBackpressure = "backpressure"
+	dropOversized    = "oversized"
+	dropRejected     = "rejected"
+)
+
+// auditRecord accounts for the messages of a container dropped for one reason
+type auditRecord struct {
+	Container   string    `json:"container"`
+	ContainerID string    `json:"containerId"`
+	Reason      string    `json:"reason"`
+	Count       int       `json:"count"`
+	First       time.Time `json:"first"`
+	Last        time.Time `json:"last"`
+}
+
+// auditLog aggregates dropped messages and periodically appends them to a file
+type auditLog struct {
+	mutex    sync.Mutex
+	file     *os.File
+	interval time.Duration
+	pending  map[string]*auditRecord
+}
+
+func newAuditLog(path string, interval time.Duration) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &auditLog{
+		file:     file,
+		interval: interval,
+		pending:  make(map[string]*auditRecord),
+	}
+	go l.run()
+
+	return l, nil
+}
+
+// Count a dropped message, a nil audit log records nothing
+func (l *auditLog) record(name string, id string, reason string, count int) {
+	if l == nil || count < 1 {
+		return
+	}
+
+	now := time.Now()
+	key := id + "/" + reason
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	r, ok := l.pending[key]
+	if !ok {
+		r = &auditRecord{Container: name, ContainerID: id, Reason: reason, First: now}
+		l.pending[key] = r
+	}
+	r.Count += count
+	r.Last = now
+}
+
+// Count every message of a batch that was dropped
+func (l *auditLog) recordBatch(buffer []*map[string]interface{}, reason string) {
+	if l == nil {
+		return
+	}
+
+	for _, data := range buffer {
+		meta := newTemplateData(*data)
+		name := meta.Container
+		if name != "" {
+			name = "/" + name
+		}
+		l.record(name, meta.ContainerID, reason, 1)
+	}
+}
+
+// Account for an event a sink gave up as its destination would not take it,
+// once whatever the retries of its batch
+func (a *HTTPAdapter) dropEvent(data *map[string]interface{}, reason string) {
+	if _, given := a.givenUp.LoadOrStore(data, true); given {
+		return
+	}
+
+	debug("http: route:", a.route.ID, "dropping event:", reason)
+	a.audit.recordBatch([]*map[string]interface{}{data}, reason)
+	a.metrics.count("dropped", 1, "reason", reason)
+}
+
+// Account for events a sink gave up without knowing which ones, e.g. when
+// its destination only reports how many it rejected
+func (a *HTTPAdapter) dropCount(count int64, reason string) {
+	debug("http: route:", a.route.ID, "dropping events:", count, reason)
+	a.audit.record("", "", reason, int(count))
+	a.metrics.count("dropped", count, "reason", reason)
+}
+
+// The events of a batch the sink did not give up, forgetting those it did
+func (a *HTTPAdapter) settle(buffer []*map[string]interface{}) []*map[string]interface{} {
+	kept := buffer[:0:0]
+	for _, data := range buffer {
+		if _, given := a.givenUp.LoadAndDelete(data); !given {
+			kept = append(kept, data)
+		}
+	}
+
+	return kept
+}
+
+// Write the pending records every interval
+func (l *auditLog) run() {
+	for range time.Tick(l.interval) {
+		l.write()
+	}
+}
+
+func (l *auditLog) write() {
+	l.mutex.Lock()
+	pending := l.pending
+	l.pending = make(map[string]*auditRecord)
+	l.mutex.Unlock()
+
+	for _, r := range pending {
+		line, err := json.Marshal(r)
+		if err != nil {
+			debug("http: audit: error encoding JSON:", err)
+			continue
+		}
+
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			debug("http: audit: error writing record:", err)
+			return
+		}
+	}
+}
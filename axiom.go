@@ -0,0 +1,88 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"text/template"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// axiomFormat posts events to the ingest endpoint of an Axiom dataset per
+// stack
+type axiomFormat struct {
+	url     string
+	header  http.Header
+	dataset *template.Template
+}
+
+// NewAxiomAdapter creates an adapter ingesting into Axiom, e.g.
+// axiom://api.axiom.co
+func NewAxiomAdapter(route *router.Route) (router.LogAdapter, error) {
+	token := getStringParameter(route.Options, "axiom.token", "")
+	if token == "" {
+		return nil, fmt.Errorf("axiom: axiom.token is required")
+	}
+
+	adapter := newHTTPAdapter(route)
+	format := &axiomFormat{
+		url:     adapter.url,
+		header:  http.Header{},
+		dataset: parseTemplate("axiom.dataset", getStringParameter(route.Options, "axiom.dataset", "{{.Stack}}")),
+	}
+	format.header.Set("Authorization", "Bearer "+token)
+	debug("axiom: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as one request per dataset, the timestamp of the events
+// becomes the _time field Axiom expects
+func (f *axiomFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	bodies := make(map[string]*bytes.Buffer)
+	var datasets []string
+
+	for _, data := range buffer {
+		row := make(map[string]interface{}, len(*data))
+		for k, v := range *data {
+			row[k] = v
+		}
+		if timestamp, ok := row["@timestamp"]; ok {
+			row["_time"] = timestamp
+			delete(row, "@timestamp")
+		}
+
+		event, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		dataset := renderTemplate(f.dataset, *data)
+		body, ok := bodies[dataset]
+		if !ok {
+			body = new(bytes.Buffer)
+			bodies[dataset] = body
+			datasets = append(datasets, dataset)
+		}
+		body.Write(event)
+		body.WriteByte('\n')
+	}
+
+	payloads := make([]*httpPayload, 0, len(datasets))
+	for _, dataset := range datasets {
+		payloads = append(payloads, &httpPayload{
+			url:         fmt.Sprintf("%s/v1/datasets/%s/ingest", f.url, url.PathEscape(dataset)),
+			contentType: "application/x-ndjson",
+			header:      f.header,
+			body:        bodies[dataset].Bytes(),
+		})
+	}
+
+	return payloads, nil
+}
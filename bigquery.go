@@ -0,0 +1,262 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+	"golang.org/x/oauth2/google"
+)
+
+// BigQuery accepts at most 500 rows per streaming insert request
+const bigqueryMaxRows = 500
+
+// bigquerySink streams events into a BigQuery table through the insertAll
+// API, authenticated with the Application Default Credentials
+type bigquerySink struct {
+	client     *http.Client
+	tablesUrl  string
+	table      string
+	messageKey string
+	retries    int
+	created    bool
+	drop       func(data *map[string]interface{}, reason string)
+}
+
+// A row of an insertAll request
+type bigqueryRow struct {
+	InsertId string                 `json:"insertId"`
+	Json     map[string]interface{} `json:"json"`
+	data     *map[string]interface{}
+}
+
+// The per row errors of an insertAll response
+type bigqueryInsertResponse struct {
+	InsertErrors []struct {
+		Index  int `json:"index"`
+		Errors []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"insertErrors"`
+}
+
+// Schema of the table created when missing, the metadata get their own
+// columns and the whole event is kept as JSON
+var bigquerySchema = []map[string]string{
+	{"name": "timestamp", "type": "TIMESTAMP", "mode": "REQUIRED"},
+	{"name": "stack", "type": "STRING"},
+	{"name": "service", "type": "STRING"},
+	{"name": "container", "type": "STRING"},
+	{"name": "container_id", "type": "STRING"},
+	{"name": "image", "type": "STRING"},
+	{"name": "hostname", "type": "STRING"},
+	{"name": "message", "type": "STRING"},
+	{"name": "event", "type": "JSON"},
+}
+
+// NewBigQueryAdapter creates an adapter streaming to
+// bigquery://project/dataset/table
+func NewBigQueryAdapter(route *router.Route) (router.LogAdapter, error) {
+	parts := strings.Split(route.Address, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("bigquery: address must be project/dataset/table: %s", route.Address)
+	}
+
+	client, err := google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/bigquery.insertdata",
+		"https://www.googleapis.com/auth/bigquery")
+	if err != nil {
+		return nil, fmt.Errorf("bigquery: cannot find default credentials: %s", err)
+	}
+
+	adapter := newAdapter(route)
+	s := &bigquerySink{
+		client:     client,
+		tablesUrl:  fmt.Sprintf("https://bigquery.googleapis.com/bigquery/v2/projects/%s/datasets/%s/tables", parts[0], parts[1]),
+		table:      parts[2],
+		messageKey: adapter.parser.messageKey,
+		retries:    getIntParameter(route.Options, "bigquery.retries", 3),
+		drop:       adapter.dropEvent,
+	}
+	debug("bigquery: table:", route.Address)
+
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Map an event to a row of the table
+func (s *bigquerySink) row(data *map[string]interface{}, index int) (bigqueryRow, error) {
+	event, err := json.Marshal(data)
+	if err != nil {
+		return bigqueryRow{}, fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	timestamp := time.Now()
+	if t, ok := (*data)["@timestamp"].(time.Time); ok {
+		timestamp = t
+	}
+	message, _ := (*data)[s.messageKey].(string)
+
+	meta := newTemplateData(*data)
+	return bigqueryRow{
+		// Lets BigQuery drop the rows of a retried request it already has
+		InsertId: meta.ContainerID + "-" + strconv.FormatInt(timestamp.UnixNano(), 10) + "-" + strconv.Itoa(index),
+		Json: map[string]interface{}{
+			"timestamp":    timestamp.Format(time.RFC3339Nano),
+			"stack":        meta.Stack,
+			"service":      meta.Service,
+			"container":    meta.Container,
+			"container_id": meta.ContainerID,
+			"image":        meta.Image,
+			"hostname":     meta.Hostname,
+			"message":      message,
+			"event":        string(event),
+		},
+		data: data,
+	}, nil
+}
+
+// Stream the batch, retrying the rows BigQuery did not insert
+func (s *bigquerySink) send(buffer []*map[string]interface{}) error {
+	rows := make([]bigqueryRow, 0, len(buffer))
+	for i, data := range buffer {
+		row, err := s.row(data, i)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > bigqueryMaxRows {
+			n = bigqueryMaxRows
+		}
+		if err := s.insertWithRetries(rows[:n]); err != nil {
+			return err
+		}
+		rows = rows[n:]
+	}
+
+	return nil
+}
+
+func (s *bigquerySink) insertWithRetries(rows []bigqueryRow) error {
+	var err error
+
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
+		rows, err = s.insert(rows)
+		if err == nil && len(rows) == 0 {
+			return nil
+		}
+		if err != nil {
+			debug("bigquery: error on insert:", err)
+		}
+	}
+
+	if err == nil {
+		err = fmt.Errorf("%d rows not inserted after %d retries", len(rows), s.retries)
+	}
+
+	return err
+}
+
+// Insert rows and return those to retry, the invalid rows are given up as
+// retrying them cannot succeed
+func (s *bigquerySink) insert(rows []bigqueryRow) ([]bigqueryRow, error) {
+	var response bigqueryInsertResponse
+	status, err := s.call(fmt.Sprintf("%s/%s/insertAll", s.tablesUrl, s.table),
+		map[string]interface{}{"rows": rows}, &response)
+	if status == http.StatusNotFound && !s.created {
+		if err := s.createTable(); err != nil {
+			return rows, err
+		}
+		return rows, fmt.Errorf("table %s created", s.table)
+	}
+	if err != nil {
+		return rows, err
+	}
+
+	var retry []bigqueryRow
+	for _, insertError := range response.InsertErrors {
+		invalid := false
+		for _, e := range insertError.Errors {
+			if e.Reason == "invalid" {
+				invalid = true
+				debug("bigquery: dropping invalid row:", e.Message)
+			}
+		}
+		if insertError.Index >= len(rows) {
+			continue
+		}
+		if invalid {
+			s.drop(rows[insertError.Index].data, dropRejected)
+		} else {
+			retry = append(retry, rows[insertError.Index])
+		}
+	}
+
+	return retry, nil
+}
+
+// Create the table with the schema of the rows
+func (s *bigquerySink) createTable() error {
+	s.created = true
+	table := map[string]interface{}{
+		"tableReference":   map[string]string{"tableId": s.table},
+		"schema":           map[string]interface{}{"fields": bigquerySchema},
+		"timePartitioning": map[string]string{"type": "DAY", "field": "timestamp"},
+	}
+
+	status, err := s.call(s.tablesUrl, table, nil)
+	if status == http.StatusConflict {
+		return nil
+	}
+	if err == nil {
+		debug("bigquery: created table:", s.table)
+	}
+
+	return err
+}
+
+// POST a request to the API and decode its response
+func (s *bigquerySink) call(url string, request interface{}, response interface{}) (int, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	resp, err := s.client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("error on client.Post: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("response not 200 but %d: %s", resp.StatusCode, body)
+	}
+
+	if response != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			return resp.StatusCode, fmt.Errorf("error decoding JSON: %s", err)
+		}
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
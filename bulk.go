@@ -0,0 +1,215 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Characters not allowed in index and data stream names
+var invalidIndexChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// bulkFormat sends batches through the _bulk API of Elasticsearch or
+// OpenSearch, retrying the items rejected with a 429
+type bulkFormat struct {
+	url     string
+	header  http.Header
+	index   *template.Template
+	action  string
+	retries int
+	signer  *v4.Signer
+	region  string
+	service string
+	drop    func(data *map[string]interface{}, reason string)
+}
+
+// A bulk response, each item is keyed by its action
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// NewBulkAdapter creates an adapter indexing into Elasticsearch or
+// OpenSearch, e.g. opensearch+https://search-logs.us-east-1.es.amazonaws.com
+func NewBulkAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newHTTPAdapter(route)
+
+	format := &bulkFormat{
+		url:     adapter.url,
+		header:  http.Header{},
+		index:   parseTemplate("bulk.index", getStringParameter(route.Options, "bulk.index", "logs-{{.Stack}}-{{.Service}}")),
+		action:  "index",
+		retries: getIntParameter(route.Options, "bulk.retries", 3),
+		drop:    adapter.dropEvent,
+	}
+
+	// http.path may already name the _bulk endpoint, e.g. behind a gateway
+	if !strings.HasSuffix(format.url, "/_bulk") {
+		format.url += "/_bulk"
+	}
+
+	// Data streams only accept create actions
+	if getStringParameter(route.Options, "bulk.datastream", "false") == "true" {
+		format.action = "create"
+	}
+
+	if user := getStringParameter(route.Options, "bulk.user", ""); user != "" {
+		request := &http.Request{Header: http.Header{}}
+		request.SetBasicAuth(user, getStringParameter(route.Options, "bulk.password", ""))
+		format.header.Set("Authorization", request.Header.Get("Authorization"))
+	}
+
+	// Amazon OpenSearch domains, or serverless collections with the aoss
+	// service, authenticate with SigV4 and the AWS credentials
+	if getStringParameter(route.Options, "opensearch.sigv4", "false") == "true" {
+		sess, err := newAWSSession(getStringParameter(route.Options, "aws.region", ""))
+		if err != nil {
+			return nil, fmt.Errorf("opensearch: cannot create session: %s", err)
+		}
+		format.signer = v4.NewSigner(sess.Config.Credentials)
+		format.region = aws.StringValue(sess.Config.Region)
+		format.service = getStringParameter(route.Options, "opensearch.service", "es")
+		if adapter.compression != "none" {
+			return nil, fmt.Errorf("opensearch: sigv4 cannot sign compressed bodies, set http.compression=none")
+		}
+	}
+	debug("bulk: url:", format.url, "action:", format.action)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Name of the index of an event, lowercased and stripped of the characters
+// Elasticsearch and OpenSearch reject, so names stay ISM and ILM friendly
+func (f *bulkFormat) indexName(data map[string]interface{}) string {
+	name := renderTemplate(f.index, data)
+	name = invalidIndexChars.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.TrimLeft(name, "-_.")
+	if name == "" {
+		name = "logs"
+	}
+
+	return name
+}
+
+// Encode the batch as action and document lines
+func (f *bulkFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	var body bytes.Buffer
+
+	for _, data := range buffer {
+		action, err := json.Marshal(map[string]interface{}{
+			f.action: map[string]string{"_index": f.indexName(*data)},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		event, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(event)
+		body.WriteByte('\n')
+	}
+
+	return []*httpPayload{{
+		url:         f.url,
+		contentType: "application/x-ndjson",
+		header:      f.header,
+		body:        body.Bytes(),
+		events:      buffer,
+	}}, nil
+}
+
+// Check the items of a bulk response, the items rejected with a 429 are
+// retried and the other failures dropped as retrying cannot fix them
+func (f *bulkFormat) check(payload *httpPayload, body []byte) (*httpPayload, error) {
+	var response bulkResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error decoding bulk response: %s", err)
+	}
+	if !response.Errors {
+		return nil, nil
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(payload.body, []byte("\n")), []byte("\n"))
+	var retry bytes.Buffer
+	var events []*map[string]interface{}
+	rejected := 0
+
+	for i, item := range response.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			if result.Status == http.StatusTooManyRequests && 2*i+1 < len(lines) {
+				retry.Write(lines[2*i])
+				retry.WriteByte('\n')
+				retry.Write(lines[2*i+1])
+				retry.WriteByte('\n')
+				if i < len(payload.events) {
+					events = append(events, payload.events[i])
+				}
+				rejected++
+				continue
+			}
+			debug("bulk: dropping item:", result.Status, string(result.Error))
+			if i < len(payload.events) {
+				f.drop(payload.events[i], dropRejected)
+			}
+		}
+	}
+
+	if rejected == 0 {
+		return nil, nil
+	}
+	if payload.attempt >= f.retries {
+		return nil, fmt.Errorf("%d items rejected after %d retries", rejected, f.retries)
+	}
+	debug("bulk: retrying", rejected, "rejected items")
+
+	return &httpPayload{
+		url:         payload.url,
+		contentType: payload.contentType,
+		header:      payload.header,
+		body:        retry.Bytes(),
+		attempt:     payload.attempt + 1,
+		events:      events,
+	}, nil
+}
+
+// Sign the request with SigV4 when enabled
+func (f *bulkFormat) sign(request *http.Request) error {
+	if f.signer == nil {
+		return nil
+	}
+
+	body, err := request.GetBody()
+	if err != nil {
+		return err
+	}
+	payload, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.signer.Sign(request, bytes.NewReader(payload), f.service, f.region, time.Now())
+	return err
+}
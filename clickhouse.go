@@ -0,0 +1,98 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// clickhouseFormat inserts batches as JSONEachRow rows through the HTTP
+// interface of ClickHouse
+type clickhouseFormat struct {
+	url     string
+	header  http.Header
+	columns [][2]string
+}
+
+// NewClickHouseAdapter creates an adapter inserting into ClickHouse, e.g.
+// clickhouse://clickhouse:8123 or clickhouse+https://clickhouse:8443
+func NewClickHouseAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newHTTPAdapter(route)
+
+	table := getStringParameter(route.Options, "clickhouse.table", "logs")
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", table))
+	// Accept the RFC 3339 timestamps of the events in DateTime64 columns
+	query.Set("date_time_input_format", "best_effort")
+	// Skip the fields without a column rather than failing the insert
+	query.Set("input_format_skip_unknown_fields", "1")
+
+	format := &clickhouseFormat{
+		url:    adapter.url + "?" + query.Encode(),
+		header: http.Header{},
+	}
+	if user := getStringParameter(route.Options, "clickhouse.user", ""); user != "" {
+		format.header.Set("X-ClickHouse-User", user)
+		format.header.Set("X-ClickHouse-Key", secretParameter(route.Options, "clickhouse.password", ""))
+	}
+
+	// Map columns to the fields of the events, e.g.
+	// clickhouse.columns=ts=@timestamp,container=docker.name
+	columns := getStringParameter(route.Options, "clickhouse.columns", "")
+	for _, mapping := range strings.Split(columns, ",") {
+		if mapping == "" {
+			continue
+		}
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("clickhouse: column mapping must be column=path: %s", mapping)
+		}
+		format.columns = append(format.columns, [2]string{parts[0], parts[1]})
+	}
+	debug("clickhouse: table:", table, "columns:", format.columns)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as one row per event, mapped to the columns when set
+func (f *clickhouseFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	var body bytes.Buffer
+
+	for _, data := range buffer {
+		var row interface{} = data
+		if len(f.columns) > 0 {
+			generic, err := genericEvent(data)
+			if err != nil {
+				return nil, err
+			}
+
+			mapped := make(map[string]interface{}, len(f.columns))
+			for _, column := range f.columns {
+				mapped[column[0]] = eventPath(generic, column[1])
+			}
+			row = mapped
+		}
+
+		event, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		body.Write(event)
+		body.WriteByte('\n')
+	}
+
+	return []*httpPayload{{
+		url:         f.url,
+		contentType: "application/x-ndjson",
+		header:      f.header,
+		body:        body.Bytes(),
+	}}, nil
+}
@@ -0,0 +1,218 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Limits of a PutLogEvents call, each event counts 26 bytes more than its
+// message
+const (
+	cloudwatchMaxBatchBytes  = 1024 * 1024
+	cloudwatchMaxBatchCount  = 10000
+	cloudwatchEventOverhead  = 26
+	cloudwatchMaxEventBytes  = 256*1024 - cloudwatchEventOverhead
+	cloudwatchMaxBatchPeriod = 24 * time.Hour
+)
+
+// cloudwatchSink puts events to CloudWatch Logs, in a log group and stream
+// per stack and service created on demand
+type cloudwatchSink struct {
+	client *cloudwatchlogs.CloudWatchLogs
+	group  *template.Template
+	stream *template.Template
+	tokens map[[2]string]*string
+	drop   func(data *map[string]interface{}, reason string)
+	mutex  sync.Mutex
+}
+
+// An event of a stream and the event it was encoded from
+type cloudwatchEntry struct {
+	event *cloudwatchlogs.InputLogEvent
+	data  *map[string]interface{}
+}
+
+// NewCloudWatchAdapter creates an adapter putting to CloudWatch Logs in a
+// region, e.g. cloudwatch://us-east-1
+func NewCloudWatchAdapter(route *router.Route) (router.LogAdapter, error) {
+	sess, err := newAWSSession(getStringParameter(route.Options, "aws.region", route.Address))
+	if err != nil {
+		return nil, fmt.Errorf("cloudwatch: cannot create session: %s", err)
+	}
+	debug("cloudwatch: region:", aws.StringValue(sess.Config.Region))
+
+	adapter := newAdapter(route)
+	adapter.sink = &cloudwatchSink{
+		client: cloudwatchlogs.New(sess),
+		group:  parseTemplate("cloudwatch.group", getStringParameter(route.Options, "cloudwatch.group", "/rancher/{{.Stack}}")),
+		stream: parseTemplate("cloudwatch.stream", getStringParameter(route.Options,
+			"cloudwatch.stream", "{{.Service}}/{{.Hostname}}")),
+		tokens: make(map[[2]string]*string),
+		drop:   adapter.dropEvent,
+	}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Put the batch, events are grouped by log stream and sorted by time as
+// CloudWatch requires
+func (s *cloudwatchSink) send(buffer []*map[string]interface{}) error {
+	streams := make(map[[2]string][]cloudwatchEntry)
+	var keys [][2]string
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+		if len(event) > cloudwatchMaxEventBytes {
+			s.drop(data, dropOversized)
+			continue
+		}
+
+		timestamp := time.Now()
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			timestamp = t
+		}
+
+		key := [2]string{renderTemplate(s.group, *data), renderTemplate(s.stream, *data)}
+		if _, ok := streams[key]; !ok {
+			keys = append(keys, key)
+		}
+		streams[key] = append(streams[key], cloudwatchEntry{
+			event: &cloudwatchlogs.InputLogEvent{
+				Message:   aws.String(string(event)),
+				Timestamp: aws.Int64(timestamp.UnixNano() / int64(time.Millisecond)),
+			},
+			data: data,
+		})
+	}
+
+	// Sequence tokens are per stream, puts to a stream must not overlap
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range keys {
+		events := streams[key]
+		sort.SliceStable(events, func(i, j int) bool {
+			return *events[i].event.Timestamp < *events[j].event.Timestamp
+		})
+
+		// A call is limited in count, size and time span
+		start, size := 0, 0
+		for i, entry := range events {
+			eventSize := len(*entry.event.Message) + cloudwatchEventOverhead
+			span := time.Duration(*entry.event.Timestamp-*events[start].event.Timestamp) * time.Millisecond
+			if i > start && (i-start == cloudwatchMaxBatchCount || size+eventSize > cloudwatchMaxBatchBytes ||
+				span >= cloudwatchMaxBatchPeriod) {
+				if err := s.put(key, events[start:i]); err != nil {
+					return err
+				}
+				start, size = i, 0
+			}
+			size += eventSize
+		}
+		if err := s.put(key, events[start:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Put events to a stream with its sequence token, creating the group and
+// the stream when they don't exist
+func (s *cloudwatchSink) put(key [2]string, entries []cloudwatchEntry) error {
+	events := make([]*cloudwatchlogs.InputLogEvent, len(entries))
+	for i, entry := range entries {
+		events[i] = entry.event
+	}
+	created := false
+
+	for attempt := 0; attempt < 5; attempt++ {
+		output, err := s.client.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(key[0]),
+			LogStreamName: aws.String(key[1]),
+			LogEvents:     events,
+			SequenceToken: s.tokens[key],
+		})
+		if err == nil {
+			s.tokens[key] = output.NextSequenceToken
+			if info := output.RejectedLogEventsInfo; info != nil {
+				debug("cloudwatch: events rejected:", info.String())
+				for i, entry := range entries {
+					if cloudwatchRejected(info, i) {
+						s.drop(entry.data, dropRejected)
+					}
+				}
+			}
+			return nil
+		}
+
+		switch e := err.(type) {
+		case *cloudwatchlogs.InvalidSequenceTokenException:
+			// Another writer put to the stream, or the token was lost
+			debug("cloudwatch: refreshing sequence token of", key[0], key[1])
+			s.tokens[key] = e.ExpectedSequenceToken
+		case *cloudwatchlogs.DataAlreadyAcceptedException:
+			s.tokens[key] = e.ExpectedSequenceToken
+			return nil
+		case *cloudwatchlogs.ResourceNotFoundException:
+			if created {
+				return fmt.Errorf("error on PutLogEvents: %s", err)
+			}
+			if err := s.create(key); err != nil {
+				return err
+			}
+			created = true
+		default:
+			return fmt.Errorf("error on PutLogEvents: %s", err)
+		}
+	}
+
+	return fmt.Errorf("error on PutLogEvents: sequence token of %s %s keeps changing", key[0], key[1])
+}
+
+// Create the log group and stream, ignoring those which already exist
+func (s *cloudwatchSink) create(key [2]string) error {
+	debug("cloudwatch: creating", key[0], key[1])
+
+	_, err := s.client.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String(key[0])})
+	if err != nil && !cloudwatchExists(err) {
+		return fmt.Errorf("error on CreateLogGroup: %s", err)
+	}
+
+	_, err = s.client.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(key[0]),
+		LogStreamName: aws.String(key[1]),
+	})
+	if err != nil && !cloudwatchExists(err) {
+		return fmt.Errorf("error on CreateLogStream: %s", err)
+	}
+	delete(s.tokens, key)
+
+	return nil
+}
+
+func cloudwatchExists(err error) bool {
+	e, ok := err.(awserr.Error)
+	return ok && e.Code() == cloudwatchlogs.ErrCodeResourceAlreadyExistsException
+}
+
+// Whether the event at an index of a put was rejected as too old, expired
+// or too new, the end indexes being exclusive
+func cloudwatchRejected(info *cloudwatchlogs.RejectedLogEventsInfo, i int) bool {
+	return (info.TooOldLogEventEndIndex != nil && int64(i) < *info.TooOldLogEventEndIndex) ||
+		(info.ExpiredLogEventEndIndex != nil && int64(i) < *info.ExpiredLogEventEndIndex) ||
+		(info.TooNewLogEventStartIndex != nil && int64(i) >= *info.TooNewLogEventStartIndex)
+}
@@ -0,0 +1,115 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Severities of Coralogix log entries, by lowercased level
+var coralogixSeverities = map[string]int{
+	"debug": 1, "trace": 2, "verbose": 2, "info": 3, "notice": 3,
+	"warn": 4, "warning": 4, "error": 5, "err": 5, "critical": 6, "fatal": 6, "panic": 6,
+}
+
+// coralogixFormat posts events to the Coralogix logs API, in an envelope
+// per application and subsystem
+type coralogixFormat struct {
+	url         string
+	privateKey  string
+	application *template.Template
+	subsystem   *template.Template
+	levelKey    string
+}
+
+// A log entry of the envelope, the text is the JSON event
+type coralogixEntry struct {
+	Timestamp float64 `json:"timestamp"`
+	Severity  int     `json:"severity"`
+	Text      string  `json:"text"`
+}
+
+// NewCoralogixAdapter creates an adapter ingesting into Coralogix, e.g.
+// coralogix://api.coralogix.com
+func NewCoralogixAdapter(route *router.Route) (router.LogAdapter, error) {
+	privateKey := getStringParameter(route.Options, "coralogix.private_key", "")
+	if privateKey == "" {
+		return nil, fmt.Errorf("coralogix: coralogix.private_key is required")
+	}
+
+	adapter := newHTTPAdapter(route)
+	format := &coralogixFormat{
+		url:        adapter.url + "/api/v1/logs",
+		privateKey: privateKey,
+		application: parseTemplate("coralogix.application", getStringParameter(route.Options,
+			"coralogix.application", "{{.Stack}}")),
+		subsystem: parseTemplate("coralogix.subsystem", getStringParameter(route.Options,
+			"coralogix.subsystem", "{{.Service}}")),
+		levelKey: getStringParameter(route.Options, "coralogix.level_key", "level"),
+	}
+	debug("coralogix: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as one envelope per application and subsystem
+func (f *coralogixFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	entries := make(map[[2]string][]coralogixEntry)
+	var envelopes [][2]string
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		timestamp := time.Now()
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			timestamp = t
+		}
+		severity := 3
+		if level, ok := (*data)[f.levelKey].(string); ok {
+			if s, ok := coralogixSeverities[strings.ToLower(level)]; ok {
+				severity = s
+			}
+		}
+
+		key := [2]string{renderTemplate(f.application, *data), renderTemplate(f.subsystem, *data)}
+		if _, ok := entries[key]; !ok {
+			envelopes = append(envelopes, key)
+		}
+		entries[key] = append(entries[key], coralogixEntry{
+			Timestamp: float64(timestamp.UnixNano()) / float64(time.Millisecond),
+			Severity:  severity,
+			Text:      string(event),
+		})
+	}
+
+	payloads := make([]*httpPayload, 0, len(envelopes))
+	for _, key := range envelopes {
+		body, err := json.Marshal(map[string]interface{}{
+			"privateKey":      f.privateKey,
+			"applicationName": key[0],
+			"subsystemName":   key[1],
+			"logEntries":      entries[key],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		payloads = append(payloads, &httpPayload{
+			url:         f.url,
+			contentType: "application/json",
+			body:        body,
+		})
+	}
+
+	return payloads, nil
+}
@@ -0,0 +1,115 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Limits of the Datadog logs intake, per log and per request
+const (
+	datadogMaxLogBytes     = 1024 * 1024
+	datadogMaxPayloadBytes = 5 * 1024 * 1024
+	datadogMaxLogs         = 1000
+)
+
+// datadogFormat posts events to the Datadog logs intake, tagged with their
+// Rancher stack and service
+type datadogFormat struct {
+	url     string
+	header  http.Header
+	source  string
+	service *template.Template
+	tags    *template.Template
+	drop    func(data *map[string]interface{}, reason string)
+}
+
+// NewDatadogAdapter creates an adapter sending to the Datadog logs intake,
+// e.g. datadog://http-intake.logs.datadoghq.eu
+func NewDatadogAdapter(route *router.Route) (router.LogAdapter, error) {
+	apiKey := secretParameter(route.Options, "datadog.apikey", "DD_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("datadog: datadog.apikey is required")
+	}
+
+	adapter := newHTTPAdapter(route)
+	format := &datadogFormat{
+		url:     adapter.url + "/api/v2/logs",
+		header:  http.Header{},
+		source:  getStringParameter(route.Options, "datadog.source", "rancher"),
+		service: parseTemplate("datadog.service", getStringParameter(route.Options, "datadog.service", "{{.Service}}")),
+		tags: parseTemplate("datadog.tags", getStringParameter(route.Options,
+			"datadog.tags", "stack:{{.Stack}},container:{{.Container}}")),
+		drop: adapter.dropEvent,
+	}
+	format.header.Set("DD-API-KEY", apiKey)
+	debug("datadog: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as JSON arrays of at most 1000 logs and 5MB, a log
+// larger than 1MB is dropped as the intake would truncate it
+func (f *datadogFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	var payloads []*httpPayload
+	body := new(bytes.Buffer)
+	count := 0
+
+	closeBody := func() {
+		body.WriteByte(']')
+		payloads = append(payloads, &httpPayload{
+			url:         f.url,
+			contentType: "application/json",
+			header:      f.header,
+			body:        body.Bytes(),
+		})
+		body = new(bytes.Buffer)
+		count = 0
+	}
+
+	for _, data := range buffer {
+		meta := newTemplateData(*data)
+
+		row := make(map[string]interface{}, len(*data)+4)
+		for k, v := range *data {
+			row[k] = v
+		}
+		row["ddsource"] = f.source
+		row["ddtags"] = renderTemplate(f.tags, *data)
+		row["service"] = renderTemplate(f.service, *data)
+		row["hostname"] = meta.Hostname
+
+		event, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		if len(event) > datadogMaxLogBytes {
+			f.drop(data, dropOversized)
+			continue
+		}
+
+		if count > 0 && (count == datadogMaxLogs || body.Len()+len(event)+1 > datadogMaxPayloadBytes) {
+			closeBody()
+		}
+		if count == 0 {
+			body.WriteByte('[')
+		} else {
+			body.WriteByte(',')
+		}
+		body.Write(event)
+		count++
+	}
+
+	if count > 0 {
+		closeBody()
+	}
+
+	return payloads, nil
+}
@@ -0,0 +1,155 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// deadLetters spools undeliverable batches to a directory, one file per
+// batch, the oldest ones being removed once they exceed maxBytes
+type deadLetters struct {
+	dir      string
+	maxBytes int64
+}
+
+// Write a batch as a JSON array, false when it was not written; a nil spool
+// writes nothing
+func (d *deadLetters) write(buffer []*map[string]interface{}) bool {
+	if d == nil {
+		return false
+	}
+
+	payload, err := json.Marshal(buffer)
+	if err != nil {
+		debug("http: dead-letter: error encoding JSON:", err)
+		return false
+	}
+
+	// Write to a temporary name first so a replay never reads a partial batch
+	name := filepath.Join(d.dir, fmt.Sprintf("%d.json", time.Now().UnixNano()))
+	if err := ioutil.WriteFile(name+".tmp", payload, 0644); err != nil {
+		debug("http: dead-letter: error writing batch:", err)
+		return false
+	}
+
+	if err := os.Rename(name+".tmp", name); err != nil {
+		debug("http: dead-letter: error writing batch:", err)
+		return false
+	}
+
+	debug("http: dead-letter: spooled batch:", name)
+	d.trim()
+
+	return true
+}
+
+// Remove the oldest batches until the spool fits maxBytes, 0 keeps them all
+func (d *deadLetters) trim() {
+	if d.maxBytes <= 0 {
+		return
+	}
+
+	names, err := d.list()
+	if err != nil {
+		debug("http: dead-letter: cannot list batches:", err)
+		return
+	}
+
+	sizes := make([]int64, len(names))
+	var total int64
+	for i, name := range names {
+		if info, err := os.Stat(name); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+
+	// The batch just written is kept even when it exceeds the limit alone
+	for i := 0; i < len(names)-1 && total > d.maxBytes; i++ {
+		if err := os.Remove(names[i]); err != nil {
+			debug("http: dead-letter: cannot remove batch:", err, names[i])
+			continue
+		}
+		total -= sizes[i]
+		log.Println("http: dead-letter: over", d.maxBytes, "bytes, removed oldest batch:", names[i])
+	}
+}
+
+// List the spooled batches, oldest first
+func (d *deadLetters) list() ([]string, error) {
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, filepath.Join(d.dir, entry.Name()))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Re-send the spooled batches through the normal delivery path, waiting
+// delay between batches so the collector isn't flooded after an outage
+func (a *HTTPAdapter) replayDeadLetters(delay time.Duration) {
+	names, err := a.deadletter.list()
+	if err != nil {
+		debug("http: dead-letter: cannot list batches:", err)
+		return
+	}
+
+	for _, name := range names {
+		payload, err := ioutil.ReadFile(name)
+		if err != nil {
+			debug("http: dead-letter: cannot read batch:", err, name)
+			continue
+		}
+
+		var buffer []*map[string]interface{}
+		if err := json.Unmarshal(payload, &buffer); err != nil {
+			debug("http: dead-letter: cannot decode batch:", err, name)
+			continue
+		}
+
+		// Batches spooled before http.idempotency was enabled have no ID
+		if a.instance != "" {
+			for _, data := range buffer {
+				if deliveryID(*data) == "" {
+					a.stampDelivery(*data)
+				}
+			}
+		}
+
+		// A rejected batch is set aside so it does not hold back the others,
+		// the remaining ones are kept if the endpoint is still unavailable
+		err = a.sendWithRetry(buffer)
+		shipped := a.settle(buffer)
+		if rejected(err) {
+			log.Println("http: dead-letter: batch rejected, quarantined:", err, name+".rejected")
+			if err := os.Rename(name, name+".rejected"); err != nil {
+				debug("http: dead-letter: cannot quarantine batch:", err, name)
+			}
+			continue
+		} else if err != nil {
+			debug("http: dead-letter: replay stopped:", err, name)
+			return
+		}
+
+		a.metrics.count("shipped", int64(len(shipped)))
+		os.Remove(name)
+		debug("http: dead-letter: replayed batch:", name)
+
+		time.Sleep(delay)
+	}
+}
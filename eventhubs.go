@@ -0,0 +1,169 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Event Hubs rejects batches over 1MB
+const eventHubsMaxBatchBytes = 1024 * 1024
+
+// eventHubsSink sends events to an Azure Event Hub through its HTTPS API,
+// authenticated with a shared access signature
+type eventHubsSink struct {
+	client  *http.Client
+	url     string
+	keyName string
+	key     string
+}
+
+// An event of a batch send request
+type eventHubsMessage struct {
+	Body             string            `json:"Body"`
+	BrokerProperties map[string]string `json:"BrokerProperties,omitempty"`
+}
+
+// NewEventHubsAdapter creates an adapter sending to
+// eventhubs://namespace.servicebus.windows.net/hub
+func NewEventHubsAdapter(route *router.Route) (router.LogAdapter, error) {
+	s := &eventHubsSink{
+		client:  &http.Client{Timeout: time.Minute},
+		url:     fmt.Sprintf("https://%s/messages", route.Address),
+		keyName: getStringParameter(route.Options, "eventhubs.sas.keyname", ""),
+		key:     secretParameter(route.Options, "eventhubs.sas.key", ""),
+	}
+
+	// A connection string as shown by the portal holds the policy, and the
+	// hub when it has an EntityPath; there is no default environment
+	// variable, which would send a namespace's key to the others
+	if connection := secretParameter(route.Options, "eventhubs.connection_string", ""); connection != "" {
+		if err := s.parseConnectionString(connection); err != nil {
+			return nil, fmt.Errorf("eventhubs: %s", err)
+		}
+	}
+	if s.keyName == "" || s.key == "" {
+		return nil, fmt.Errorf("eventhubs: eventhubs.connection_string, or eventhubs.sas.keyname and eventhubs.sas.key are required")
+	}
+	debug("eventhubs: url:", s.url)
+
+	adapter := newAdapter(route)
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Take the policy and the hub of a connection string, e.g.
+// Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=...;EntityPath=hub
+func (s *eventHubsSink) parseConnectionString(connection string) error {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(connection, ";") {
+		if parts := strings.SplitN(field, "=", 2); len(parts) == 2 {
+			fields[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	s.keyName = fields["sharedaccesskeyname"]
+	s.key = fields["sharedaccesskey"]
+	if s.keyName == "" || s.key == "" {
+		return fmt.Errorf("connection string without SharedAccessKeyName or SharedAccessKey")
+	}
+
+	if fields["endpoint"] != "" && fields["entitypath"] != "" {
+		endpoint, err := url.Parse(fields["endpoint"])
+		if err != nil {
+			return fmt.Errorf("invalid connection string endpoint: %s", err)
+		}
+		s.url = fmt.Sprintf("https://%s/%s/messages", endpoint.Host, fields["entitypath"])
+	}
+
+	return nil
+}
+
+// Create a shared access signature for the hub, valid for an hour
+func (s *eventHubsSink) signature() string {
+	resource := url.QueryEscape(s.url)
+	expiry := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(s.key))
+	mac.Write([]byte(resource + "\n" + expiry))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s",
+		resource, url.QueryEscape(signature), expiry, s.keyName)
+}
+
+// Send the batch, the container ID is the partition key of its events
+func (s *eventHubsSink) send(buffer []*map[string]interface{}) error {
+	var messages []eventHubsMessage
+	size := 0
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		message := eventHubsMessage{Body: string(event)}
+		if id := newTemplateData(*data).ContainerID; id != "" {
+			message.BrokerProperties = map[string]string{"PartitionKey": id}
+		}
+
+		// Stay under the batch size limit, with room for the envelope
+		if len(messages) > 0 && size+len(event)*2 > eventHubsMaxBatchBytes {
+			if err := s.post(messages); err != nil {
+				return err
+			}
+			messages, size = nil, 0
+		}
+		messages = append(messages, message)
+		size += len(event)*2 + 128
+	}
+
+	if len(messages) > 0 {
+		return s.post(messages)
+	}
+
+	return nil
+}
+
+func (s *eventHubsSink) post(messages []eventHubsMessage) error {
+	payload, err := json.Marshal(messages)
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	request, err := http.NewRequest("POST", s.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error on http.NewRequest: %s", err)
+	}
+	request.Header.Set("Content-Type", "application/vnd.microsoft.servicebus.json")
+	request.Header.Set("Authorization", s.signature())
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error on client.Do: %s", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 201 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("response not 201 but %d: %s", response.StatusCode, body)
+	}
+	io.Copy(ioutil.Discard, response.Body)
+
+	return nil
+}
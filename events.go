@@ -0,0 +1,149 @@
+package logspoutRancher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Container lifecycle actions shipped as log events
+var lifecycleActions = map[string]bool{
+	"create": true,
+	"start":  true,
+	"die":    true,
+	"oom":    true,
+	"kill":   true,
+}
+
+// Lifecycle event data for event data
+type LifecycleEvent struct {
+	Action   string `json:"action"`
+	ExitCode string `json:"exitCode,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	Time     int64  `json:"time"`
+}
+
+// Healthcheck status and last probe result for event data
+type HealthEvent struct {
+	Status        string `json:"status"`
+	FailingStreak int    `json:"failingStreak"`
+	ExitCode      int    `json:"exitCode"`
+	Output        string `json:"output,omitempty"`
+}
+
+// Connect to the docker daemon the same way logspout does, through DOCKER_HOST
+func newDockerClient() *docker.Client {
+	client, err := docker.NewClientFromEnv()
+	if err != nil {
+		die("", "http: unable to connect to docker:", err)
+	}
+
+	return client
+}
+
+// Subscribe to the docker events API and queue the container lifecycle
+// events, enriched like log messages
+func (a *HTTPAdapter) watchEvents() {
+	listener := make(chan *docker.APIEvents)
+	if err := a.docker.AddEventListener(listener); err != nil {
+		die("", "http: unable to listen to docker events:", err)
+	}
+
+	for event := range listener {
+		if event.Type != "container" {
+			continue
+		}
+
+		// Older daemons only fill the Status of the event
+		action := event.Action
+		if action == "" {
+			action = event.Status
+		}
+
+		// Release the cached data of removed containers
+		if action == "destroy" {
+			a.forgetContainer(event.Actor.ID)
+		}
+
+		// Ship the last lines of an exiting container right away, after a
+		// grace period for the lines logspout is still reading
+		if action == "die" && a.flushOnExit {
+			time.AfterFunc(a.flushOnExitDelay, func() {
+				a.flushes <- "exit"
+			})
+		}
+
+		// Health transitions are reported as "health_status: healthy"
+		if strings.HasPrefix(action, "health_status") {
+			if a.healthEvents {
+				a.queueHealthEvent(event)
+			}
+		} else if a.lifecycleEvents && lifecycleActions[action] {
+			a.queueLifecycleEvent(action, event)
+		}
+	}
+}
+
+func (a *HTTPAdapter) queueLifecycleEvent(action string, event *docker.APIEvents) {
+	container, err := a.docker.InspectContainer(event.Actor.ID)
+	if err != nil {
+		debug("http: events: cannot inspect container:", err, event.Actor.ID)
+		return
+	}
+
+	data := map[string]interface{}{
+		a.parser.messageKey: fmt.Sprintf("container %s %s", container.Name, action),
+		"event": LifecycleEvent{
+			Action:   action,
+			ExitCode: event.Actor.Attributes["exitCode"],
+			Signal:   event.Actor.Attributes["signal"],
+			Time:     event.Time,
+		},
+	}
+
+	if !a.enrich(data, container) {
+		a.audit.record(container.Name, container.ID, dropFiltered, 1)
+		a.metrics.count("dropped", 1, "reason", dropFiltered)
+		return
+	}
+
+	a.queue <- &data
+}
+
+func (a *HTTPAdapter) queueHealthEvent(event *docker.APIEvents) {
+	container, err := a.docker.InspectContainer(event.Actor.ID)
+	if err != nil {
+		debug("http: events: cannot inspect container:", err, event.Actor.ID)
+		return
+	}
+
+	health := HealthEvent{
+		Status:        container.State.Health.Status,
+		FailingStreak: container.State.Health.FailingStreak,
+	}
+
+	// Include the result of the probe that caused the transition
+	if probes := container.State.Health.Log; len(probes) > 0 {
+		health.ExitCode = probes[len(probes)-1].ExitCode
+		health.Output = strings.TrimSpace(probes[len(probes)-1].Output)
+	}
+
+	data := map[string]interface{}{
+		a.parser.messageKey: fmt.Sprintf("container %s is %s", container.Name, health.Status),
+		"event": LifecycleEvent{
+			Action: "health_status",
+			Time:   event.Time,
+		},
+		"health": health,
+	}
+
+	if !a.enrich(data, container) {
+		a.audit.record(container.Name, container.ID, dropFiltered, 1)
+		a.metrics.count("dropped", 1, "reason", dropFiltered)
+		return
+	}
+
+	a.queue <- &data
+}
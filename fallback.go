@@ -0,0 +1,94 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net"
+	"strings"
+)
+
+// Path of the native journald socket on the host
+const journaldSocket = "/run/systemd/journal/socket"
+
+// fallbackWriter keeps a local copy of events the endpoint did not accept
+type fallbackWriter interface {
+	Write(event []byte) (int, error)
+}
+
+// Create the fallback writer selected by the http.fallback option
+func newFallbackWriter(kind string) (fallbackWriter, error) {
+	switch kind {
+	case "syslog":
+		return syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "logspout")
+	case "journald":
+		return newJournaldWriter(journaldSocket)
+	}
+
+	return nil, fmt.Errorf("unknown fallback %q", kind)
+}
+
+// journaldWriter sends entries to journald using its native datagram protocol
+type journaldWriter struct {
+	conn *net.UnixConn
+}
+
+func newJournaldWriter(path string) (*journaldWriter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldWriter{conn: conn}, nil
+}
+
+// Write sends a single journal entry, the event is the MESSAGE field
+func (j *journaldWriter) Write(event []byte) (int, error) {
+	return j.writeFields([][2]string{
+		{"SYSLOG_IDENTIFIER", "logspout"},
+		{"PRIORITY", "6"},
+		{"MESSAGE", string(event)},
+	})
+}
+
+// Send a journal entry made of fields, values holding a newline use the
+// binary form of the protocol
+func (j *journaldWriter) writeFields(fields [][2]string) (int, error) {
+	var entry bytes.Buffer
+	for _, field := range fields {
+		if !strings.Contains(field[1], "\n") {
+			entry.WriteString(field[0] + "=" + field[1] + "\n")
+			continue
+		}
+
+		entry.WriteString(field[0] + "\n")
+		binary.Write(&entry, binary.LittleEndian, uint64(len(field[1])))
+		entry.WriteString(field[1] + "\n")
+	}
+
+	return j.conn.Write(entry.Bytes())
+}
+
+// Divert the events of an undeliverable batch to the local fallback
+func (a *HTTPAdapter) divert(buffer []*map[string]interface{}) {
+	if a.fallback == nil {
+		return
+	}
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			debug("http: fallback: error encoding JSON:", err)
+			continue
+		}
+
+		if _, err := a.fallback.Write(event); err != nil {
+			debug("http: fallback: error writing event:", err)
+			return
+		}
+	}
+
+	debug("http: fallback: diverted messages:", len(buffer))
+}
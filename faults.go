@@ -0,0 +1,78 @@
+package logspoutRancher
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// faultInjector randomly fails deliveries and Rancher lookups with the
+// probabilities of the http.faults.* options, for resilience testing
+type faultInjector struct {
+	errorRate    float64
+	throttleRate float64
+	latencyRate  float64
+	latency      time.Duration
+	rancherRate  float64
+	random       *rand.Rand
+	mutex        sync.Mutex
+}
+
+// Create an injector, nil when no fault is configured
+func newFaultInjector(options map[string]string) *faultInjector {
+	f := &faultInjector{
+		errorRate:    getFloatParameter(options, "http.faults.error", 0),
+		throttleRate: getFloatParameter(options, "http.faults.throttle", 0),
+		latencyRate:  getFloatParameter(options, "http.faults.latency.probability", 0),
+		latency:      getDurationParameter(options, "http.faults.latency", 0),
+		rancherRate:  getFloatParameter(options, "http.faults.rancher", 0),
+		random:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if f.latency > 0 && f.latencyRate == 0 {
+		f.latencyRate = 1
+	}
+
+	if f.errorRate == 0 && f.throttleRate == 0 && f.latency == 0 && f.rancherRate == 0 {
+		return nil
+	}
+
+	return f
+}
+
+// Whether a fault of probability p happens
+func (f *faultInjector) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.random.Float64() < p
+}
+
+// Whether a Rancher lookup fails, as if the API had returned an error
+func (f *faultInjector) rancherFails() bool {
+	return f != nil && f.roll(f.rancherRate)
+}
+
+// faultySink delays or fails the batches before they reach the real sink
+type faultySink struct {
+	sink   sink
+	faults *faultInjector
+}
+
+func (s *faultySink) send(buffer []*map[string]interface{}) error {
+	if s.faults.roll(s.faults.latencyRate) {
+		time.Sleep(s.faults.latency)
+	}
+	if s.faults.roll(s.faults.errorRate) {
+		return fmt.Errorf("injected failure")
+	}
+	if s.faults.roll(s.faults.throttleRate) {
+		return fmt.Errorf("response not 2xx but 429 (injected)")
+	}
+
+	return s.sink.send(buffer)
+}
@@ -0,0 +1,100 @@
+package logspoutRancher
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// containerFilter applies logspout's exclusion conventions: containers with
+// LOGSPOUT=ignore in their environment or carrying the exclusion label
+type containerFilter struct {
+	excludeLabel string
+	excludeValue string
+}
+
+// Build the filter from EXCLUDE_LABEL (label or label:value) and
+// EXCLUDE_VALUE, both overridable per route
+func newContainerFilter(options map[string]string) *containerFilter {
+	excludeLabel := getStringParameter(options, "http.exclude.label", os.Getenv("EXCLUDE_LABEL"))
+	excludeValue := getStringParameter(options, "http.exclude.value", os.Getenv("EXCLUDE_VALUE"))
+
+	if parts := strings.SplitN(excludeLabel, ":", 2); len(parts) == 2 {
+		excludeLabel, excludeValue = parts[0], parts[1]
+	}
+	if excludeValue == "" {
+		excludeValue = "true"
+	}
+
+	return &containerFilter{excludeLabel: excludeLabel, excludeValue: excludeValue}
+}
+
+// Check if the messages of the container must not be shipped
+func (f *containerFilter) excluded(c *docker.Container) bool {
+	for _, e := range c.Config.Env {
+		if strings.EqualFold(e, "LOGSPOUT=ignore") {
+			return true
+		}
+	}
+
+	if f.excludeLabel == "" {
+		return false
+	}
+
+	value, ok := c.Config.Labels[f.excludeLabel]
+
+	return ok && strings.EqualFold(value, f.excludeValue)
+}
+
+// activityTracker remembers when each container last logged, so the per
+// container caches can be released once a container has been inactive for
+// the timeout
+type activityTracker struct {
+	mutex    sync.Mutex
+	timeout  time.Duration
+	lastSeen map[string]time.Time
+}
+
+func newActivityTracker(timeout time.Duration) *activityTracker {
+	return &activityTracker{timeout: timeout, lastSeen: make(map[string]time.Time)}
+}
+
+// Record activity of a container, a nil tracker records nothing
+func (t *activityTracker) touch(containerID string) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	t.lastSeen[containerID] = time.Now()
+	t.mutex.Unlock()
+}
+
+// Forget and return the containers inactive for longer than the timeout
+func (t *activityTracker) inactive() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var ids []string
+	for id, seen := range t.lastSeen {
+		if time.Since(seen) > t.timeout {
+			ids = append(ids, id)
+			delete(t.lastSeen, id)
+		}
+	}
+
+	return ids
+}
+
+// Release the cached data of inactive containers every timeout
+func (a *HTTPAdapter) evictInactive() {
+	for range time.Tick(a.activity.timeout) {
+		for _, id := range a.activity.inactive() {
+			a.forgetContainer(id)
+			debug("http: released cache of inactive container:", id)
+		}
+	}
+}
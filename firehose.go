@@ -0,0 +1,114 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Limits of Firehose records and of their batch calls
+const (
+	firehoseMaxRecordBytes = 1000 * 1024
+	firehoseMaxBatchBytes  = 4 * 1024 * 1024
+	firehoseMaxBatchCount  = 500
+)
+
+// firehoseSink puts events to a Kinesis Data Firehose delivery stream,
+// one newline terminated record per event
+type firehoseSink struct {
+	client  *firehose.Firehose
+	stream  string
+	retries int
+	drop    func(data *map[string]interface{}, reason string)
+}
+
+// NewFirehoseAdapter creates an adapter putting to
+// firehose://delivery-stream
+func NewFirehoseAdapter(route *router.Route) (router.LogAdapter, error) {
+	sess, err := newAWSSession(getStringParameter(route.Options, "aws.region", ""))
+	if err != nil {
+		return nil, fmt.Errorf("firehose: cannot create session: %s", err)
+	}
+	debug("firehose: stream:", route.Address)
+
+	adapter := newAdapter(route)
+	adapter.sink = &firehoseSink{
+		client:  firehose.New(sess),
+		stream:  route.Address,
+		retries: getIntParameter(route.Options, "firehose.retries", 3),
+		drop:    adapter.dropEvent,
+	}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Put the batch in calls of at most 500 records and 4MB, a record larger
+// than 1000KB is dropped
+func (s *firehoseSink) send(buffer []*map[string]interface{}) error {
+	var records []*firehose.Record
+	size := 0
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+		event = append(event, '\n')
+
+		if len(event) > firehoseMaxRecordBytes {
+			s.drop(data, dropOversized)
+			continue
+		}
+
+		if len(records) == firehoseMaxBatchCount || size+len(event) > firehoseMaxBatchBytes {
+			if err := s.put(records); err != nil {
+				return err
+			}
+			records, size = nil, 0
+		}
+		records = append(records, &firehose.Record{Data: event})
+		size += len(event)
+	}
+
+	if len(records) > 0 {
+		return s.put(records)
+	}
+
+	return nil
+}
+
+// Put the records, retrying those failing on their own, e.g. throttled;
+// once the retries are exhausted the error fails the whole batch, so the
+// records already put are sent again with it
+func (s *firehoseSink) put(records []*firehose.Record) error {
+	for attempt := 0; ; attempt++ {
+		output, err := s.client.PutRecordBatch(&firehose.PutRecordBatchInput{
+			DeliveryStreamName: aws.String(s.stream),
+			Records:            records,
+		})
+		if err != nil {
+			return fmt.Errorf("error on PutRecordBatch: %s", err)
+		}
+		if aws.Int64Value(output.FailedPutCount) == 0 {
+			return nil
+		}
+
+		var failed []*firehose.Record
+		var reason string
+		for i, response := range output.RequestResponses {
+			if response.ErrorCode != nil {
+				failed = append(failed, records[i])
+				reason = aws.StringValue(response.ErrorMessage)
+			}
+		}
+		if attempt >= s.retries {
+			return fmt.Errorf("PutRecordBatch failed for %d records: %s", len(failed), reason)
+		}
+		debug("firehose: retrying", len(failed), "failed records:", reason)
+		records = failed
+	}
+}
@@ -0,0 +1,82 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// httpPayload is a request body shaped by a format and where to send it
+type httpPayload struct {
+	url         string
+	contentType string
+	header      http.Header
+	body        []byte
+	attempt     int
+	batchID     string
+	// The events of the body in order, for the formats checking each of them
+	events []*map[string]interface{}
+}
+
+// httpFormat shapes a batch into the requests an HTTP endpoint expects, a
+// payload without url is sent to the url of the route
+type httpFormat interface {
+	encode(buffer []*map[string]interface{}) ([]*httpPayload, error)
+}
+
+// responseChecker is implemented by the formats whose endpoint reports
+// errors in the body of successful responses, it returns a payload with
+// the items to retry if any
+type responseChecker interface {
+	check(payload *httpPayload, body []byte) (*httpPayload, error)
+}
+
+// requestSigner is implemented by the formats whose endpoint authenticates
+// requests with a signature of their body
+type requestSigner interface {
+	sign(request *http.Request) error
+}
+
+// jsonArrayFormat POSTs the batch as a JSON array, the default format
+type jsonArrayFormat struct{}
+
+func (jsonArrayFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	// Create JSON representation of all messages
+	payload, err := json.Marshal(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	return []*httpPayload{{body: payload}}, nil
+}
+
+// Convert an event to plain JSON values, so its fields can be looked up by path
+func genericEvent(data *map[string]interface{}) (map[string]interface{}, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	var generic map[string]interface{}
+	if err := json.Unmarshal(payload, &generic); err != nil {
+		return nil, fmt.Errorf("error decoding JSON: %s", err)
+	}
+
+	return generic, nil
+}
+
+// Look up a field of a plain JSON event by its dotted path, as docker.name
+func eventPath(generic map[string]interface{}, path string) interface{} {
+	var value interface{} = generic
+
+	for _, key := range strings.Split(path, ".") {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = nested[key]
+	}
+
+	return value
+}
@@ -0,0 +1,128 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Characters not allowed in the names of GELF additional fields
+var invalidGelfChars = regexp.MustCompile(`[^\w.\-]+`)
+
+// gelfFormat posts events to a Graylog HTTP GELF input, one message per
+// request as the input expects
+type gelfFormat struct {
+	url        string
+	messageKey string
+	levelKey   string
+}
+
+// NewGELFAdapter creates an adapter posting to a Graylog HTTP GELF input,
+// e.g. gelf://graylog:12201
+func NewGELFAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newHTTPAdapter(route)
+	format := &gelfFormat{
+		url:        adapter.url + "/gelf",
+		messageKey: adapter.parser.messageKey,
+		levelKey:   getStringParameter(route.Options, "gelf.level_key", "level"),
+	}
+	debug("gelf: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode each event as a GELF message, the first line of the message is
+// the short_message and the other fields become additional fields, nested
+// ones joined by underscores as _rancher_stack_stackName
+func (f *gelfFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	payloads := make([]*httpPayload, 0, len(buffer))
+
+	for _, data := range buffer {
+		generic, err := genericEvent(data)
+		if err != nil {
+			return nil, err
+		}
+
+		timestamp := time.Now()
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			timestamp = t
+		}
+		level, ok := journalPriorities[lineLevel(*data, f.levelKey, f.messageKey)]
+		if !ok {
+			level = 6
+		}
+
+		meta := newTemplateData(*data)
+		message := map[string]interface{}{
+			"version":            "1.1",
+			"host":               meta.Hostname,
+			"timestamp":          float64(timestamp.UnixNano()) / float64(time.Second),
+			"level":              level,
+			"_rancher_stack":     meta.Stack,
+			"_rancher_service":   meta.Service,
+			"_rancher_container": meta.Container,
+			"_container_id":      meta.ContainerID,
+			"_image_name":        meta.Image,
+		}
+		if message["host"] == "" {
+			message["host"] = meta.Container
+		}
+
+		// Graylog rejects messages without short_message
+		text := "-"
+		if value, ok := generic[f.messageKey]; ok && value != nil {
+			text = fmt.Sprint(value)
+		}
+		if lines := strings.SplitN(text, "\n", 2); len(lines) > 1 {
+			message["short_message"] = lines[0]
+			message["full_message"] = text
+		} else {
+			message["short_message"] = text
+		}
+		delete(generic, f.messageKey)
+		delete(generic, "@timestamp")
+		gelfFields(message, "", generic)
+
+		payload, err := json.Marshal(message)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		payloads = append(payloads, &httpPayload{
+			url:         f.url,
+			contentType: "application/json",
+			body:        payload,
+		})
+	}
+
+	return payloads, nil
+}
+
+// Add the fields of an event as additional fields, without overwriting the
+// fields already set
+func gelfFields(message map[string]interface{}, prefix string, fields map[string]interface{}) {
+	for key, value := range fields {
+		name := prefix + "_" + invalidGelfChars.ReplaceAllString(key, "_")
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			gelfFields(message, name, v)
+			continue
+		case []interface{}:
+			encoded, _ := json.Marshal(v)
+			value = string(encoded)
+		case nil:
+			continue
+		}
+
+		if _, ok := message[name]; !ok && name != "_id" {
+			message[name] = value
+		}
+	}
+}
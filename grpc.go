@@ -0,0 +1,175 @@
+package logspoutRancher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// grpcSink sends each batch of log records on its own call of a client
+// streaming method of the LogIngest contract in proto/logspout.proto, the
+// batch being delivered once the service answers the call
+type grpcSink struct {
+	conn       *grpc.ClientConn
+	method     string
+	messageKey string
+	timeout    time.Duration
+}
+
+// Messages are encoded by the sink, the codec passes the bytes through
+type grpcRawCodec struct{}
+
+func (grpcRawCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := v.(*[]byte); ok {
+		return *b, nil
+	}
+	return nil, fmt.Errorf("unexpected message type %T", v)
+}
+
+func (grpcRawCodec) Unmarshal(data []byte, v interface{}) error {
+	if b, ok := v.(*[]byte); ok {
+		*b = append((*b)[:0], data...)
+		return nil
+	}
+	return fmt.Errorf("unexpected message type %T", v)
+}
+
+func (grpcRawCodec) Name() string {
+	return "proto"
+}
+
+// NewGRPCAdapter creates an adapter streaming to a gRPC service, e.g.
+// grpc://ingest:9090 or grpc+tls://ingest:443
+func NewGRPCAdapter(route *router.Route) (router.LogAdapter, error) {
+	creds, err := grpcCredentials(route, "grpc")
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(route.Address, grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(grpcRawCodec{})))
+	if err != nil {
+		return nil, fmt.Errorf("grpc: cannot dial %s: %s", route.Address, err)
+	}
+
+	adapter := newAdapter(route)
+	s := &grpcSink{
+		conn:       conn,
+		method:     getStringParameter(route.Options, "grpc.method", "/logspout.v1.LogIngest/Push"),
+		messageKey: adapter.parser.messageKey,
+		timeout:    getDurationParameter(route.Options, "grpc.timeout", 10*time.Second),
+	}
+	debug("grpc:", route.Address, "method:", s.method)
+
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Credentials of a connection, TLS when the transport of the route is tls
+// as in grpc+tls://ingest:443, configured by the <prefix>.tls options
+func grpcCredentials(route *router.Route, prefix string) (credentials.TransportCredentials, error) {
+	if route.AdapterTransport("") != "tls" {
+		return insecure.NewCredentials(), nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: getStringParameter(route.Options, prefix+".tls.skipverify", "false") == "true",
+	}
+	if ca := getStringParameter(route.Options, prefix+".tls.ca", ""); ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("%s: cannot read CA: %s", prefix, err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		config.RootCAs.AppendCertsFromPEM(pem)
+	}
+	if cert := getStringParameter(route.Options, prefix+".tls.cert", ""); cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, getStringParameter(route.Options, prefix+".tls.key", ""))
+		if err != nil {
+			return nil, fmt.Errorf("%s: cannot load client certificate: %s", prefix, err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return credentials.NewTLS(config), nil
+}
+
+// Encode the batch as a LogBatch message
+func (s *grpcSink) encode(buffer []*map[string]interface{}) ([]byte, error) {
+	var batch []byte
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		timestamp := time.Now()
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			timestamp = t
+		}
+		message, _ := (*data)[s.messageKey].(string)
+		meta := newTemplateData(*data)
+
+		var record []byte
+		record = protowire.AppendTag(record, 1, protowire.VarintType)
+		record = protowire.AppendVarint(record, uint64(timestamp.UnixNano()))
+		for i, value := range []string{meta.Stack, meta.Service, meta.Container, meta.ContainerID,
+			meta.Image, meta.Hostname, message} {
+			if value != "" {
+				record = protowire.AppendTag(record, protowire.Number(i+2), protowire.BytesType)
+				record = protowire.AppendString(record, value)
+			}
+		}
+		record = protowire.AppendTag(record, 9, protowire.BytesType)
+		record = protowire.AppendBytes(record, event)
+
+		batch = protowire.AppendTag(batch, 1, protowire.BytesType)
+		batch = protowire.AppendBytes(batch, record)
+	}
+
+	return batch, nil
+}
+
+// Send the batch on a call of the method and wait for the response of the
+// service, a batch without response is not delivered
+func (s *grpcSink) send(buffer []*map[string]interface{}) error {
+	batch, err := s.encode(buffer)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	stream, err := s.conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true}, s.method)
+	if err != nil {
+		return fmt.Errorf("error on NewStream: %s", err)
+	}
+	if err := stream.SendMsg(&batch); err != nil && err != io.EOF {
+		return fmt.Errorf("error on SendMsg: %s", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("error on CloseSend: %s", err)
+	}
+
+	// The PushResponse, an error when the service failed the call
+	var response []byte
+	if err := stream.RecvMsg(&response); err != nil {
+		return fmt.Errorf("error on RecvMsg: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package logspoutRancher
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// fieldHasher replaces identifiers by a salted hash before they leave the
+// host, equal values keep equal hashes so they can still be counted and
+// joined
+type fieldHasher struct {
+	salt       []byte
+	length     int
+	fields     [][]string
+	patterns   []*regexp.Regexp
+	messageKey string
+	rawKey     string
+}
+
+// Create a hasher from the http.hash.* options, nil when there is nothing
+// to hash
+func newFieldHasher(options map[string]string, parser *messageParser, schema int) (*fieldHasher, error) {
+	h := &fieldHasher{
+		salt:       []byte(getStringParameter(options, "http.hash.salt", os.Getenv("HASH_SALT"))),
+		length:     getIntParameter(options, "http.hash.length", 16),
+		messageKey: parser.messageKey,
+		rawKey:     parser.rawKey,
+	}
+
+	for _, field := range strings.Split(getStringParameter(options, "http.hash.fields", ""), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			path := strings.Split(field, ".")
+			if err := checkHashPath(path, schema); err != nil {
+				return nil, err
+			}
+			h.fields = append(h.fields, path)
+		}
+	}
+	for _, pattern := range strings.Split(getStringParameter(options, "http.hash.patterns", ""), ";") {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		h.patterns = append(h.patterns, re)
+	}
+
+	if len(h.fields) == 0 && len(h.patterns) == 0 {
+		return nil, nil
+	}
+	if len(h.salt) == 0 {
+		return nil, fmt.Errorf("http.hash.salt or HASH_SALT is required")
+	}
+	if h.length <= 0 || h.length > 64 {
+		h.length = 64
+	}
+
+	return h, nil
+}
+
+// Hash of a value, as hex
+func (h *fieldHasher) hash(value string) string {
+	mac := hmac.New(sha256.New, h.salt)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))[:h.length]
+}
+
+// Hash the fields of an event and the matches of the patterns in its message
+func (h *fieldHasher) apply(data map[string]interface{}) {
+	if h == nil {
+		return
+	}
+
+	for _, path := range h.fields {
+		h.hashPath(data, path)
+	}
+
+	for _, key := range []string{h.messageKey, h.rawKey} {
+		if message, ok := data[key].(string); ok && key != "" {
+			data[key] = h.scrub(message)
+		}
+	}
+
+	// The probe output of a health event is free text as well
+	if health, ok := data["health"].(HealthEvent); ok {
+		health.Output = h.scrub(health.Output)
+		data["health"] = health
+	} else if health, ok := data["health"].(map[string]interface{}); ok {
+		if output, ok := health["output"].(string); ok {
+			health["output"] = h.scrub(output)
+		}
+	}
+
+	// The original line would still hold the hashed fields
+	if len(h.fields) > 0 && h.rawKey != "" {
+		delete(data, h.rawKey)
+	}
+}
+
+// Hash the matches of the patterns in a text
+func (h *fieldHasher) scrub(text string) string {
+	for _, pattern := range h.patterns {
+		text = pattern.ReplaceAllStringFunc(text, h.hash)
+	}
+
+	return text
+}
+
+// Hash the value at a dotted path, nested in maps; the metadata we add is
+// replaced by its JSON view on the way, which also leaves the cached
+// metadata shared by the events of a container untouched
+func (h *fieldHasher) hashPath(data map[string]interface{}, path []string) {
+	value, ok := data[path[0]]
+	if !ok {
+		return
+	}
+
+	if len(path) > 1 {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			if nested = jsonView(value); nested == nil {
+				return
+			}
+			data[path[0]] = nested
+		}
+		h.hashPath(nested, path[1:])
+		return
+	}
+
+	switch v := value.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		// Only scalar values are hashed
+	case string:
+		data[path[0]] = h.hash(v)
+	default:
+		data[path[0]] = h.hash(fmt.Sprint(v))
+	}
+}
+
+// The JSON object a value is encoded as, nil when it is not an object
+func jsonView(value interface{}) map[string]interface{} {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+
+	var view map[string]interface{}
+	if err := json.Unmarshal(raw, &view); err != nil {
+		return nil
+	}
+
+	return view
+}
+
+// Sections we add to the events of a layout and their type, by name
+func addedSections(schema int) map[string]reflect.Type {
+	sections := map[string]reflect.Type{
+		"rancher":    reflect.TypeOf(RancherInfo{}),
+		"swarm":      reflect.TypeOf(SwarmInfo{}),
+		"compose":    reflect.TypeOf(ComposeInfo{}),
+		"kubernetes": reflect.TypeOf(KubernetesInfo{}),
+		"event":      reflect.TypeOf(LifecycleEvent{}),
+		"health":     reflect.TypeOf(HealthEvent{}),
+		"delivery":   reflect.TypeOf(DeliveryInfo{}),
+	}
+	if schema == schemaECS {
+		sections["container"] = reflect.TypeOf(ecsContainer{})
+		sections["host"] = reflect.TypeOf(struct {
+			Hostname string `json:"hostname"`
+		}{})
+		sections["service"] = reflect.TypeOf(struct {
+			Name string `json:"name"`
+		}{})
+		sections["orchestrator"] = reflect.TypeOf(struct {
+			Namespace string `json:"namespace"`
+			Type      string `json:"type"`
+		}{})
+		sections["log"] = reflect.TypeOf(struct {
+			Level string `json:"level"`
+		}{})
+	} else {
+		sections["docker"] = reflect.TypeOf(DockerInfo{})
+	}
+
+	return sections
+}
+
+// Check a path into the sections we add names one of their fields, the
+// paths into the fields of the application cannot be checked
+func checkHashPath(path []string, schema int) error {
+	if path[0] == "docker" && schema == schemaECS {
+		return fmt.Errorf("%s: the docker section is container and host with the ECS layout",
+			strings.Join(path, "."))
+	}
+
+	t, ok := addedSections(schema)[path[0]]
+	if !ok {
+		return nil
+	}
+	for _, name := range path[1:] {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Map {
+			return nil
+		}
+		if t.Kind() != reflect.Struct {
+			return fmt.Errorf("%s: %s is not an object", strings.Join(path, "."), name)
+		}
+
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == name {
+				t, found = t.Field(i).Type, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: no field %s", strings.Join(path, "."), name)
+		}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct || t.Kind() == reflect.Map || t.Kind() == reflect.Slice {
+		return fmt.Errorf("%s: only scalar fields are hashed", strings.Join(path, "."))
+	}
+
+	return nil
+}
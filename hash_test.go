@@ -0,0 +1,148 @@
+package logspoutRancher
+
+import (
+	"strings"
+	"testing"
+)
+
+var testParser = &messageParser{messageKey: "message", rawKey: "raw"}
+
+func TestHashMetadataFields(t *testing.T) {
+	h, err := newFieldHasher(map[string]string{
+		"http.hash.fields": "docker.hostname,rancher.container.ip,user.id",
+		"http.hash.salt":   "pepper",
+	}, testParser, schemaLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := &RancherInfo{Container: &RancherContainer{Name: "web-1", IP: "10.42.0.7"}}
+	data := map[string]interface{}{
+		"docker":  DockerInfo{Name: "/web-1", Hostname: "node-1"},
+		"rancher": shared,
+		"user":    map[string]interface{}{"id": 42},
+	}
+	h.apply(data)
+
+	for path, expected := range map[string]string{
+		"docker.hostname":      h.hash("node-1"),
+		"docker.name":          "/web-1",
+		"rancher.container.ip": h.hash("10.42.0.7"),
+		"user.id":              h.hash("42"),
+	} {
+		if got := valueAt(data, path); got != expected {
+			t.Errorf("%s: expected %v, got %v", path, expected, got)
+		}
+	}
+	if shared.Container.IP != "10.42.0.7" {
+		t.Errorf("the cached rancher metadata was modified: %s", shared.Container.IP)
+	}
+}
+
+func TestHashECSFields(t *testing.T) {
+	h, err := newFieldHasher(map[string]string{
+		"http.hash.fields": "container.name,host.hostname",
+		"http.hash.salt":   "pepper",
+	}, testParser, schemaECS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &HTTPAdapter{schema: schemaECS, parser: testParser}
+	data := map[string]interface{}{"docker": DockerInfo{Name: "/web-1", Hostname: "node-1"}}
+	a.applySchema(data)
+	h.apply(data)
+
+	for path, expected := range map[string]string{
+		"container.name": h.hash("web-1"),
+		"host.hostname":  h.hash("node-1"),
+	} {
+		if got := valueAt(data, path); got != expected {
+			t.Errorf("%s: expected %v, got %v", path, expected, got)
+		}
+	}
+}
+
+func TestHashInvalidPaths(t *testing.T) {
+	for _, test := range []struct {
+		fields string
+		schema int
+	}{
+		{"docker.nope", schemaLegacy},
+		{"docker.hostname.name", schemaLegacy},
+		{"rancher.container", schemaLegacy},
+		{"docker.hostname", schemaECS},
+		{"host.name", schemaECS},
+	} {
+		_, err := newFieldHasher(map[string]string{
+			"http.hash.fields": test.fields,
+			"http.hash.salt":   "pepper",
+		}, testParser, test.schema)
+		if err == nil {
+			t.Errorf("%s (schema %d): expected an error", test.fields, test.schema)
+		}
+	}
+
+	for _, fields := range []string{"rancher.container.labels.team", "app.client.ip", "kubernetes.namespace"} {
+		if _, err := newFieldHasher(map[string]string{
+			"http.hash.fields": fields,
+			"http.hash.salt":   "pepper",
+		}, testParser, schemaNested); err != nil {
+			t.Errorf("%s: unexpected error: %s", fields, err)
+		}
+	}
+}
+
+// The value at a dotted path of the JSON maps left by the hasher
+func valueAt(data map[string]interface{}, path string) interface{} {
+	var value interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			if nested = jsonView(value); nested == nil {
+				return nil
+			}
+		}
+		value = nested[key]
+	}
+
+	return value
+}
+
+func TestHashPatterns(t *testing.T) {
+	h, err := newFieldHasher(map[string]string{
+		"http.hash.patterns": `\b\d{1,3}(\.\d{1,3}){3}\b`,
+		"http.hash.salt":     "pepper",
+		"http.hash.length":   "8",
+	}, testParser, schemaLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]map[string]interface{}{
+		"message": {"message": "connection from 10.42.0.7 refused"},
+		"typed":   {"health": HealthEvent{Output: "connection from 10.42.0.7 refused"}},
+		"decoded": {"health": map[string]interface{}{"output": "connection from 10.42.0.7 refused"}},
+	} {
+		h.apply(data)
+
+		expected := "connection from " + h.hash("10.42.0.7") + " refused"
+		var got interface{}
+		switch name {
+		case "message":
+			got = data["message"]
+		default:
+			got = valueAt(data, "health.output")
+		}
+		if got != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, got)
+		}
+	}
+
+	if _, err := newFieldHasher(map[string]string{"http.hash.patterns": "("}, testParser, schemaLegacy); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+	if _, err := newFieldHasher(map[string]string{"http.hash.fields": "user.id"}, testParser, schemaLegacy); err == nil {
+		t.Error("expected an error without a salt")
+	}
+}
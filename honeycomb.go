@@ -0,0 +1,130 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// honeycombFormat posts events to the batch endpoint of a Honeycomb dataset
+// per stack, with the Rancher metadata as event fields
+type honeycombFormat struct {
+	url     string
+	header  http.Header
+	dataset *template.Template
+	drop    func(data *map[string]interface{}, reason string)
+}
+
+// An event of a batch request
+type honeycombEvent struct {
+	Time string                 `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// NewHoneycombAdapter creates an adapter sending to Honeycomb, e.g.
+// honeycomb://api.honeycomb.io or honeycomb://api.eu1.honeycomb.io
+func NewHoneycombAdapter(route *router.Route) (router.LogAdapter, error) {
+	apiKey := secretParameter(route.Options, "honeycomb.apikey", "HONEYCOMB_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("honeycomb: honeycomb.apikey is required")
+	}
+
+	adapter := newHTTPAdapter(route)
+	format := &honeycombFormat{
+		url:     adapter.url,
+		header:  http.Header{},
+		dataset: parseTemplate("honeycomb.dataset", getStringParameter(route.Options, "honeycomb.dataset", "{{.Stack}}")),
+		drop:    adapter.dropEvent,
+	}
+	format.header.Set("X-Honeycomb-Team", apiKey)
+	debug("honeycomb: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as one request per dataset, the timestamp of an event
+// becoming its time and its fields flattened with the Rancher metadata
+func (f *honeycombFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	events := make(map[string][]honeycombEvent)
+	sources := make(map[string][]*map[string]interface{})
+	var datasets []string
+
+	for _, data := range buffer {
+		timestamp := time.Now()
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			timestamp = t
+		}
+		meta := newTemplateData(*data)
+
+		fields := make(map[string]interface{}, len(*data)+6)
+		for k, v := range *data {
+			if k != "@timestamp" {
+				fields[k] = v
+			}
+		}
+		fields["rancher.stack"] = meta.Stack
+		fields["rancher.service"] = meta.Service
+		fields["container.name"] = meta.Container
+		fields["container.id"] = meta.ContainerID
+		fields["container.image"] = meta.Image
+		fields["host.name"] = meta.Hostname
+
+		dataset := renderTemplate(f.dataset, *data)
+		if _, ok := events[dataset]; !ok {
+			datasets = append(datasets, dataset)
+		}
+		events[dataset] = append(events[dataset], honeycombEvent{
+			Time: timestamp.UTC().Format(time.RFC3339Nano),
+			Data: fields,
+		})
+		sources[dataset] = append(sources[dataset], data)
+	}
+
+	payloads := make([]*httpPayload, 0, len(datasets))
+	for _, dataset := range datasets {
+		body, err := json.Marshal(events[dataset])
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		payloads = append(payloads, &httpPayload{
+			url:         fmt.Sprintf("%s/1/batch/%s", f.url, url.PathEscape(dataset)),
+			contentType: "application/json",
+			header:      f.header,
+			body:        body,
+			events:      sources[dataset],
+		})
+	}
+
+	return payloads, nil
+}
+
+// Check the status of each event of a batch response, the rejected events
+// are given up as retrying cannot fix them
+func (f *honeycombFormat) check(payload *httpPayload, body []byte) (*httpPayload, error) {
+	var statuses []struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &statuses); err != nil {
+		return nil, fmt.Errorf("error decoding batch response: %s", err)
+	}
+
+	for i, status := range statuses {
+		if status.Status >= 300 {
+			debug("honeycomb: dropping event:", status.Status, status.Error)
+			if i < len(payload.events) {
+				f.drop(payload.events[i], dropRejected)
+			}
+		}
+	}
+
+	return nil, nil
+}
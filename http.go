@@ -4,24 +4,30 @@ import (
 	"bytes"
 	"compress/gzip"
 	"crypto/tls"
-	"encoding/json"
+	"crypto/x509"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gliderlabs/logspout/router"
 	"github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
 )
 
+// Shared by every adapter, EncodeAll is safe for concurrent use
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
 func debug(v ...interface{}) {
 	if os.Getenv("DEBUG") != "" {
 		log.Println(v...)
@@ -58,6 +64,22 @@ func getIntParameter(
 	}
 }
 
+func getFloatParameter(
+	options map[string]string, parameterName string, dfault float64) float64 {
+
+	if value, ok := options[parameterName]; ok {
+		valueFloat, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			debug("http: invalid value for parameter:", parameterName, value)
+			return dfault
+		} else {
+			return valueFloat
+		}
+	} else {
+		return dfault
+	}
+}
+
 func getDurationParameter(
 	options map[string]string, parameterName string,
 	dfault time.Duration) time.Duration {
@@ -75,58 +97,321 @@ func getDurationParameter(
 	}
 }
 
-func dial(netw, addr string) (net.Conn, error) {
-	dial, err := net.Dial(netw, addr)
-	if err != nil {
-		debug("http: new dial", dial, err, netw, addr)
-	} else {
-		debug("http: new dial", dial, netw, addr)
+// Make a dial function giving up on connections not established within
+// the timeout
+func dialer(timeout time.Duration) func(netw, addr string) (net.Conn, error) {
+	return func(netw, addr string) (net.Conn, error) {
+		dial, err := net.DialTimeout(netw, addr, timeout)
+		if err != nil {
+			debug("http: new dial", dial, err, netw, addr)
+		} else {
+			debug("http: new dial", dial, netw, addr)
+		}
+		return dial, err
 	}
-	return dial, err
 }
 
-// HTTPAdapter is an adapter that POSTs logs to an HTTP endpoint
+// Behaviours of a flush finding http.inflight.max batches being delivered
+const (
+	backpressureBlock = "block"
+	backpressureDrop  = "drop"
+)
+
+// HTTPAdapter is an adapter that POSTs logs to an HTTP endpoint, its
+// pipeline is shared by the adapters delivering to other sinks
 type HTTPAdapter struct {
-	route  *router.Route
-	url    string
-	client *http.Client
-	buffer []*map[string]interface{}
+	route             *router.Route
+	url               string
+	client            *http.Client
+	buffer            []*map[string]interface{}
 	timer             *time.Timer
 	capacity          int
 	timeout           time.Duration
-	totalMessageCount int
+	totalMessageCount int64
 	bufferMutex       sync.Mutex
-	useGzip           bool
+	sink              sink
+	format            httpFormat
+	sentry            *sentryForwarder
+	pagerduty         *pagerDutyAlerter
+	slack             *slackNotifier
+	metrics           *logMetrics
+	levelKey          string
+	liveTail          bool
+	liveTailRemote    chan []byte
+	recentSize        int
+	schema            int
+	faults            *faultInjector
+	hasher            *fieldHasher
+	quota             *logQuota
+	rancher           *rancherMetadata
+	retryMax          int
+	retryInitial      time.Duration
+	retryMaxDelay     time.Duration
+	authorization     string
+	headers           http.Header
+	method            string
+	payloadMaxBytes   int
+	requestLimit      *rateLimiter
+	eventLimit        *rateLimiter
+	queue             chan *map[string]interface{}
+	backfill          chan *router.Message
+	docker            *docker.Client
+	lifecycleEvents   bool
+	healthEvents      bool
+	flushOnExit       bool
+	flushOnExitDelay  time.Duration
+	flushes           chan string
+	compression       string
 	crash             bool
-	logstashFields    map[string]map[string]string
+	fallback          fallbackWriter
+	audit             *auditLog
+	deadletter        *deadLetters
+	spool             *diskBuffer
+	memory            *memoryBudget
+	inflight          sync.WaitGroup
+	inflightSlots     chan struct{}
+	backpressure      string
+	requeued          []*map[string]interface{}
+	requeuedBytes     int64
+	requeueMax        int
+	instance          string
+	sequence          int64
+	shutdownTimeout   time.Duration
+	bufferBytes       int64
+	givenUp           sync.Map
+	logstashFields    map[string]*fieldsCacheEntry
+	fieldsMutex       sync.Mutex
+	routeFields       string
+	fieldsTTL         time.Duration
+	filter            *containerFilter
+	parser            *messageParser
+	activity          *activityTracker
+	started           time.Time
+	tailOnly          bool
+}
+
+// sink delivers a batch of enriched events to the destination of a route
+type sink interface {
+	send(buffer []*map[string]interface{}) error
 }
 
 // NewHTTPAdapter creates an HTTPAdapter
 func NewHTTPAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newHTTPAdapter(route)
+	adapter.format = jsonArrayFormat{}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Create an adapter sending to the HTTP endpoint of the route, the caller
+// sets the format then starts it
+func newHTTPAdapter(route *router.Route) *HTTPAdapter {
 
 	// Figure out the URI and create the HTTP client
 	defaultPath := ""
 	path := getStringParameter(route.Options, "http.path", defaultPath)
-	endpointUrl := fmt.Sprintf("%s://%s%s", route.Adapter, route.Address, path)
+	endpointUrl := fmt.Sprintf("%s://%s%s", endpointScheme(route), route.Address, path)
+
+	// http+unix:///var/run/collector.sock sends to a local agent through its
+	// socket, the host of the URL is only used for the Host header
+	socket := ""
+	if route.AdapterTransport("") == "unix" {
+		socket = route.Address
+		endpointUrl = "http://" + getStringParameter(route.Options, "http.unix.host", "localhost") + path
+	}
+
+	// Send to an embedded collector printing the batches instead
+	if getStringParameter(route.Options, "http.loopback", "false") == "true" {
+		collector, err := startLoopbackCollector(
+			getStringParameter(route.Options, "http.loopback.address", "127.0.0.1:0"))
+		if err != nil {
+			die("", "http: cannot start loopback collector:", err)
+		}
+		endpointUrl = collector.url() + path
+		socket = ""
+	}
 	debug("http: url:", endpointUrl)
-	transport := &http.Transport{}
-	transport.Dial = dial
+	transport := &http.Transport{
+		TLSClientConfig:     &tls.Config{},
+		TLSHandshakeTimeout: getDurationParameter(route.Options, "http.tls.handshake.timeout", 10*time.Second),
+	}
+	transport.Dial = dialer(getDurationParameter(route.Options, "http.dial.timeout", 30*time.Second))
+	if socket != "" {
+		dialSocket := transport.Dial
+		transport.Dial = func(netw, addr string) (net.Conn, error) {
+			return dialSocket("unix", socket)
+		}
+		debug("http: unix socket:", socket)
+	}
 
 	// Figure out if we need a proxy
 	defaultProxyUrl := ""
 	proxyUrlString := getStringParameter(route.Options, "http.proxy", defaultProxyUrl)
-	if proxyUrlString != "" {
+	if proxyUrlString == "env" {
+		// HTTP_PROXY, HTTPS_PROXY and NO_PROXY like the rest of the tooling
+		transport.Proxy = http.ProxyFromEnvironment
+		debug("http: proxy from environment")
+	} else if proxyUrlString != "" {
 		proxyUrl, err := url.Parse(proxyUrlString)
 		if err != nil {
 			die("", "http: cannot parse proxy url:", err, proxyUrlString)
 		}
 		transport.Proxy = http.ProxyURL(proxyUrl)
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 		debug("http: proxy url:", proxyUrl)
 	}
 
-	// Create the client
-	client := &http.Client{Transport: transport}
+	// Certificates are verified unless disabled, which historically was the
+	// case when going through a proxy
+	defaultSkipVerify := "false"
+	if proxyUrlString != "" && proxyUrlString != "env" {
+		defaultSkipVerify = "true"
+	}
+	if getStringParameter(route.Options, "http.tls.skipverify", defaultSkipVerify) == "true" {
+		transport.TLSClientConfig.InsecureSkipVerify = true
+		debug("http: not verifying the endpoint certificate")
+	}
+
+	// Present a client certificate to endpoints requiring mutual TLS
+	certFile := getStringParameter(route.Options, "http.tls.cert", "")
+	if certFile != "" {
+		keyFile := getStringParameter(route.Options, "http.tls.key", "")
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			die("", "http: cannot load client certificate:", err, certFile, keyFile)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		debug("http: client certificate:", certFile)
+	}
+
+	// Verify endpoints whose certificate is signed by an internal CA
+	caFile := getStringParameter(route.Options, "http.tls.ca", "")
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			die("", "http: cannot read CA bundle:", err, caFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			die("", "http: no certificate found in CA bundle:", caFile)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+		debug("http: CA bundle:", caFile)
+	}
+
+	// A custom dial disables HTTP/2 unless it is explicitly attempted
+	if getStringParameter(route.Options, "http.http2", "false") == "true" {
+		transport.ForceAttemptHTTP2 = true
+		debug("http: HTTP/2 enabled")
+	}
+
+	// Create the client, a hung endpoint mustn't block the flushes forever
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   getDurationParameter(route.Options, "http.timeout", time.Minute),
+	}
+
+	// Figure out which compression to use, http.gzip predates zstd
+	compression := "none"
+	if getStringParameter(route.Options, "http.gzip", "false") == "true" {
+		compression = "gzip"
+	}
+	compression = getStringParameter(route.Options, "http.compression", compression)
+	if _, ok := compressors[compression]; ok {
+		debug("http:", compression, "compression enabled")
+	} else if compression != "none" {
+		die("", "http: unknown compression:", compression)
+	}
+
+	// Static Authorization header, or a bearer token; as every route may use
+	// them there is no default environment variable, which would send one
+	// collector's credentials to the others
+	authorization := secretParameter(route.Options, "http.authorization", "")
+	if token := secretParameter(route.Options, "http.token", ""); token != "" && authorization == "" {
+		authorization = "Bearer " + token
+	}
+
+	// Extra headers of every request, e.g. http.header.X-Sumo-Category=prod
+	headers := http.Header{}
+	for option, value := range route.Options {
+		if strings.HasPrefix(option, "http.header.") {
+			headers.Set(strings.TrimPrefix(option, "http.header."), value)
+		}
+	}
+
+	// Some ingestion APIs want PUT or PATCH
+	method := strings.ToUpper(getStringParameter(route.Options, "http.method", "POST"))
+	if method != "POST" {
+		debug("http: method:", method)
+	}
+
+	// Endpoints rejecting large requests, e.g. http.payload.maxbytes=1000000
+	payloadMaxBytes := getIntParameter(route.Options, "http.payload.maxbytes", 0)
+	if payloadMaxBytes > 0 {
+		debug("http: payload limit:", payloadMaxBytes)
+	}
+
+	// Make the HTTP adapter
+	adapter := newAdapter(route)
+	adapter.url = endpointUrl
+	adapter.authorization = authorization
+	adapter.headers = headers
+	adapter.method = method
+	adapter.payloadMaxBytes = payloadMaxBytes
+	adapter.client = client
+	adapter.compression = compression
+	adapter.sink = adapter
+
+	return adapter
+}
+
+// Read a secret from its route option, the file named by the option with
+// a .file suffix, the environment variable named by the option with a .env
+// suffix, or the default environment variable if any, so it needn't appear
+// in the route
+func secretParameter(options map[string]string, parameterName string, envName string) string {
+	if value := getStringParameter(options, parameterName, ""); value != "" {
+		return value
+	}
+
+	if file := getStringParameter(options, parameterName+".file", ""); file != "" {
+		value, err := ioutil.ReadFile(file)
+		if err != nil {
+			die("", "http: cannot read secret file:", err, file)
+		}
+		return strings.TrimSpace(string(value))
+	}
+
+	if env := getStringParameter(options, parameterName+".env", ""); env != "" {
+		return os.Getenv(env)
+	}
+	if envName == "" {
+		return ""
+	}
+
+	return os.Getenv(envName)
+}
+
+// Modes whose endpoint is a hosted service default to https
+var httpsModes = map[string]bool{"axiom": true, "logdna": true, "coralogix": true, "papertrail": true,
+	"datadog": true, "sumo": true, "newrelic": true, "honeycomb": true}
+
+// Scheme of the endpoint, the http and https routes use their own while
+// the modes use their transport, as in clickhouse+https
+func endpointScheme(route *router.Route) string {
+	if route.Adapter == "http" || route.Adapter == "https" {
+		return route.Adapter
+	}
+	if httpsModes[route.Adapter] {
+		return route.AdapterTransport("https")
+	}
+
+	return route.AdapterTransport("http")
+}
+
+// Create the buffering and enrichment pipeline shared by all the adapters,
+// the caller sets the sink then starts it
+func newAdapter(route *router.Route) *HTTPAdapter {
 
 	// Determine the buffer capacity
 	defaultCapacity := 100
@@ -151,14 +436,6 @@ func NewHTTPAdapter(route *router.Route) (router.LogAdapter, error) {
 	}
 	timer := time.NewTimer(timeout)
 
-	// Figure out whether we should use GZIP compression
-	useGzip := false
-	useGZipString := getStringParameter(route.Options, "http.gzip", "false")
-	if useGZipString == "true" {
-		useGzip = true
-		debug("http: gzip compression enabled")
-	}
-
 	// Should we crash on an error or keep going?
 	crash := true
 	crashString := getStringParameter(route.Options, "http.crash", "true")
@@ -167,19 +444,308 @@ func NewHTTPAdapter(route *router.Route) (router.LogAdapter, error) {
 		debug("http: don't crash, keep going")
 	}
 
-	// Make the HTTP adapter
+	// Where to keep a local copy of batches the endpoint did not accept
+	var fallback fallbackWriter
+	fallbackString := getStringParameter(route.Options, "http.fallback", "")
+	if fallbackString != "" {
+		var err error
+		fallback, err = newFallbackWriter(fallbackString)
+		if err != nil {
+			die("", "http: cannot open fallback:", err, fallbackString)
+		}
+		debug("http: fallback enabled:", fallbackString)
+	}
+
+	// Optionally keep an audit trail of the messages we drop
+	var audit *auditLog
+	auditFile := getStringParameter(route.Options, "http.audit.file", "")
+	if auditFile != "" {
+		defaultAuditInterval, _ := time.ParseDuration("1m")
+		auditInterval := getDurationParameter(
+			route.Options, "http.audit.interval", defaultAuditInterval)
+		var err error
+		audit, err = newAuditLog(auditFile, auditInterval)
+		if err != nil {
+			die("", "http: cannot open audit file:", err, auditFile)
+		}
+		debug("http: audit trail:", auditFile)
+	}
+
+	// Optionally spool undeliverable batches to a dead-letter directory
+	var deadletter *deadLetters
+	deadletterDir := getStringParameter(route.Options, "http.deadletter.dir", "")
+	if deadletterDir != "" {
+		if err := os.MkdirAll(deadletterDir, 0755); err != nil {
+			die("", "http: cannot create dead-letter directory:", err, deadletterDir)
+		}
+		deadletter = &deadLetters{
+			dir:      deadletterDir,
+			maxBytes: int64(getIntParameter(route.Options, "http.deadletter.maxbytes", 256*1024*1024)),
+		}
+		debug("http: dead-letter directory:", deadletterDir, "max bytes:", deadletter.maxBytes)
+	}
+
+	// Optionally journal the buffer to disk so it survives a restart
+	var spool *diskBuffer
+	spoolDir := getStringParameter(route.Options, "http.buffer.dir", "")
+	if spoolDir != "" {
+		var err error
+		spool, err = newDiskBuffer(spoolDir)
+		if err != nil {
+			die("", "http: cannot open buffer directory:", err, spoolDir)
+		}
+		debug("http: buffer directory:", spoolDir)
+	}
+
+	// Number the events and the requests so duplicates can be told apart
+	instance := ""
+	if getStringParameter(route.Options, "http.idempotency", "false") == "true" {
+		instance = newUUID()
+		debug("http: delivery instance:", instance)
+	}
+
+	// Batches being delivered at once, 0 for no limit
+	var inflightSlots chan struct{}
+	inflightMax := getIntParameter(route.Options, "http.inflight.max", 4)
+	if inflightMax > 0 {
+		inflightSlots = make(chan struct{}, inflightMax)
+	}
+
+	// Block the stream or drop the batches when no slot is free
+	backpressure := getStringParameter(route.Options, "http.backpressure", backpressureBlock)
+	if backpressure != backpressureBlock && backpressure != backpressureDrop {
+		debug("http: invalid value for parameter: http.backpressure", backpressure,
+			"using default:", backpressureBlock)
+		backpressure = backpressureBlock
+	}
+
+	// Ship the container backlog on (re)start or only the new lines
+	tailOnly := false
+	start := getStringParameter(route.Options, "http.start", "backlog")
+	if start == "tail" {
+		tailOnly = true
+		debug("http: only shipping new lines")
+	} else if start != "backlog" {
+		debug("http: invalid value for parameter: http.start", start,
+			"using default: backlog")
+	}
+
+	// Retry failed batches with exponential backoff before giving up
+	retryMax := getIntParameter(route.Options, "http.retry.max", 3)
+	retryInitial := getDurationParameter(route.Options, "http.retry.initial", 500*time.Millisecond)
+	retryMaxDelay := getDurationParameter(route.Options, "http.retry.maxdelay", 30*time.Second)
+
+	// Layout of the events, the legacy one unless a newer one is selected
+	schema := getIntParameter(route.Options, "http.schema_version", schemaLegacy)
+	if schema < schemaLegacy || schema > schemaECS {
+		debug("http: invalid value for parameter: http.schema_version", schema)
+		schema = schemaLegacy
+	}
+	parser := newMessageParser(route.Options)
+	if schema >= schemaNested && parser.nest == "" {
+		parser.nest = "app"
+	}
+	metrics := &logMetrics{route: route.ID}
+	parser.metrics = metrics
+
 	return &HTTPAdapter{
 		route:          route,
-		url:            endpointUrl,
-		client:         client,
 		buffer:         buffer,
 		timer:          timer,
 		capacity:       capacity,
 		timeout:        timeout,
-		useGzip:        useGzip,
 		crash:          crash,
-		logstashFields: make(map[string]map[string]string),
-	}, nil
+		fallback:       fallback,
+		audit:          audit,
+		deadletter:     deadletter,
+		spool:          spool,
+		memory:         newMemoryBudget(route.Options),
+		inflightSlots:  inflightSlots,
+		backpressure:   backpressure,
+		requestLimit:   newRateLimiter(getFloatParameter(route.Options, "http.rate.limit", 0)),
+		eventLimit:     newRateLimiter(getFloatParameter(route.Options, "http.rate.events", 0)),
+		requeueMax:     getIntParameter(route.Options, "http.requeue.max", 10*capacity),
+		instance:       instance,
+		logstashFields: make(map[string]*fieldsCacheEntry),
+		routeFields:    getStringParameter(route.Options, "http.fields", ""),
+		fieldsTTL:      getDurationParameter(route.Options, "http.fields.ttl", 0),
+		queue:          make(chan *map[string]interface{}),
+		backfill:       make(chan *router.Message),
+		flushes:        make(chan string),
+		filter:         newContainerFilter(route.Options),
+		parser:         parser,
+		rancher:        rancherFor(route.Options),
+		metrics:        metrics,
+		schema:         schema,
+		retryMax:       retryMax,
+		retryInitial:   retryInitial,
+		retryMaxDelay:  retryMaxDelay,
+		started:        time.Now(),
+		tailOnly:       tailOnly,
+	}
+}
+
+// Start the background work of the adapter once its sink is set
+func (a *HTTPAdapter) start() {
+	options := a.route.Options
+
+	// Release the cached data of containers that stopped logging, logspout's
+	// INACTIVITY_TIMEOUT restarts hung streams and is unrelated;
+	// http.inactivity.timeout predates http.cache.idle
+	idle := getDurationParameter(options, "http.inactivity.timeout", 0)
+	idle = getDurationParameter(options, "http.cache.idle", idle)
+	if idle > 0 {
+		a.activity = newActivityTracker(idle)
+		go a.evictInactive()
+		debug("http: cache idle timeout:", idle)
+	}
+
+	// Ship the container lifecycle and health events alongside the logs,
+	// flush the buffer when a container exits and forget removed containers
+	a.lifecycleEvents = getStringParameter(options, "http.events", "false") == "true"
+	a.healthEvents = getStringParameter(options, "http.events.health", "false") == "true"
+	a.flushOnExit = getStringParameter(options, "http.flush.exit", "true") == "true"
+	defaultFlushOnExitDelay, _ := time.ParseDuration("500ms")
+	a.flushOnExitDelay = getDurationParameter(
+		options, "http.flush.exit.delay", defaultFlushOnExitDelay)
+	if a.lifecycleEvents || a.healthEvents || a.flushOnExit {
+		a.docker = newDockerClient()
+		go a.watchEvents()
+		debug("http: watching docker events, lifecycle:", a.lifecycleEvents,
+			"health:", a.healthEvents, "flush on exit:", a.flushOnExit)
+	}
+
+	// Ship the container logs written since a point in the past
+	sinceString := getStringParameter(options, "http.since", "")
+	if sinceString != "" {
+		since, err := parseSince(sinceString)
+		if err != nil {
+			die("", "http: cannot parse since:", err, sinceString)
+		}
+		if a.docker == nil {
+			a.docker = newDockerClient()
+		}
+		go a.backfillSince(since)
+		debug("http: shipping container logs since", since)
+	}
+
+	// Periodically ship the resource usage of the containers
+	statsInterval := getDurationParameter(options, "http.stats.interval", 0)
+	if statsInterval > 0 {
+		if a.docker == nil {
+			a.docker = newDockerClient()
+		}
+		go a.sampleStats(statsInterval)
+		debug("http: shipping container stats every", statsInterval)
+	}
+
+	// Count the lines, bytes and drops of the services in StatsD, or push
+	// them to a Prometheus remote-write endpoint
+	a.levelKey = getStringParameter(options, "http.metrics.level_key", "level")
+	if address := getStringParameter(options, "http.statsd.address", ""); address != "" {
+		statsd, err := newStatsdEmitter(address,
+			getStringParameter(options, "http.statsd.prefix", "logspout"),
+			getStringParameter(options, "http.statsd.dogstatsd", "false") == "true")
+		if err != nil {
+			die("", "http: cannot create statsd emitter:", err)
+		}
+		a.metrics.sinks = append(a.metrics.sinks, statsd)
+		go statsd.run(getDurationParameter(options, "http.statsd.interval", 10*time.Second))
+		debug("http: statsd:", address)
+	}
+	if url := getStringParameter(options, "http.remotewrite.url", ""); url != "" {
+		writer := newRemoteWriter(url, options)
+		a.metrics.sinks = append(a.metrics.sinks, writer)
+		go writer.run(getDurationParameter(options, "http.remotewrite.interval", 30*time.Second))
+		debug("http: remote write:", url)
+	}
+
+	// Send the error level lines to Sentry as well
+	if dsn := getStringParameter(options, "http.sentry.dsn", ""); dsn != "" {
+		sentry, err := newSentryForwarder(dsn, options, a.parser.messageKey)
+		if err != nil {
+			die("", "http: cannot parse sentry dsn:", err)
+		}
+		a.sentry = sentry
+		go sentry.run()
+		debug("http: forwarding error lines to sentry:", sentry.url)
+	}
+
+	// Alert PagerDuty when patterns are seen too often for a service
+	if routingKey := getStringParameter(options, "http.pagerduty.key", ""); routingKey != "" {
+		alerter, err := newPagerDutyAlerter(routingKey, options, a.parser.messageKey)
+		if err != nil {
+			die("", "http: cannot create pagerduty alerter:", err)
+		}
+		alerter.metrics = a.metrics
+		a.pagerduty = alerter
+		go alerter.run()
+		debug("http: pagerduty patterns:", alerter.patterns, "count:", alerter.count, "window:", alerter.window)
+	}
+
+	// Tell a Slack channel when patterns are seen
+	if webhook := getStringParameter(options, "http.slack.webhook", ""); webhook != "" {
+		notifier, err := newSlackNotifier(webhook, options, a.parser.messageKey)
+		if err != nil {
+			die("", "http: cannot create slack notifier:", err)
+		}
+		notifier.metrics = a.metrics
+		a.slack = notifier
+		go notifier.run()
+		debug("http: slack patterns:", notifier.patterns, "interval:", notifier.interval)
+	}
+
+	// Stream the events live to the /tail WebSocket clients, or to a
+	// remote WebSocket
+	a.liveTail = getStringParameter(options, "http.livetail", "false") == "true"
+	if url := getStringParameter(options, "http.livetail.url", ""); url != "" {
+		a.liveTailRemote = make(chan []byte, liveTailBuffer)
+		go a.streamLiveTail(url)
+		debug("http: livetail: streaming to", url)
+	}
+
+	// Keep the last events of each container for /recent
+	a.recentSize = getIntParameter(options, "http.recent.size", 0)
+
+	// Hash the identifiers before they leave the host
+	hasher, err := newFieldHasher(options, a.parser, a.schema)
+	if err != nil {
+		die("", "http: cannot create field hasher:", err)
+	}
+	a.hasher = hasher
+
+	// Limit the lines and bytes each container ships per interval
+	if quota := newLogQuota(options); quota != nil {
+		a.quota = quota
+		go a.rollQuota()
+		debug("http: quota: lines:", quota.lines, "bytes:", quota.bytes, "per", quota.interval)
+	}
+
+	// Inject failures to validate the retry, spill and backpressure settings
+	if faults := newFaultInjector(options); faults != nil {
+		a.faults = faults
+		a.sink = &faultySink{sink: a.sink, faults: faults}
+		log.Println("http: route:", a.route.ID, "fault injection enabled for", a.route.Address)
+	}
+
+	// Re-send the spooled batches in the background
+	if a.deadletter != nil && getStringParameter(options, "http.deadletter.replay", "false") == "true" {
+		defaultReplayDelay, _ := time.ParseDuration("1s")
+		replayDelay := getDurationParameter(
+			options, "http.deadletter.replay.delay", defaultReplayDelay)
+		go a.replayDeadLetters(replayDelay)
+	}
+
+	// Flush the buffer when logspout is stopped, e.g. by docker stop
+	a.shutdownTimeout = getDurationParameter(options, "http.shutdown.timeout", 5*time.Second)
+	if a.shutdownTimeout > 0 {
+		shutdown.register(a)
+	}
+
+	// Deliver the buffer spooled before the last restart
+	if a.spool != nil {
+		go a.replaySpool()
+	}
 }
 
 // Flushes the accumulated messages in the buffer
@@ -195,85 +761,359 @@ func (a *HTTPAdapter) flushHttp(reason string) {
 	// Reset the timer when we are done
 	defer a.timer.Reset(a.timeout)
 
-	// Return immediately if the buffer is empty
-	if len(a.buffer) < 1 {
+	// Return immediately if the buffer is empty and no failed batch waits
+	a.bufferMutex.Lock()
+	if len(a.buffer) < 1 && len(a.requeued) < 1 {
+		a.bufferMutex.Unlock()
 		return
 	}
 
-	// Capture the buffer and make a new one
-	a.bufferMutex.Lock()
-	buffer := a.buffer
+	// Capture the buffer, after the events of failed batches, and make a
+	// new one
+	buffer := append(a.requeued, a.buffer...)
 	a.buffer = make([]*map[string]interface{}, 0, a.capacity)
+	bufferBytes := a.bufferBytes + a.requeuedBytes
+	a.bufferBytes = 0
+	a.requeued = nil
+	a.requeuedBytes = 0
+	spooled := a.spool.seal()
 	a.bufferMutex.Unlock()
 
-	// Create JSON representation of all messages
-	payload, err := json.Marshal(buffer)
-	if err != nil {
-		debug("flushHttp - Error encoding JSON: ", err)
-		return
+	// Wait for a slot so a slow endpoint holds the stream back instead of
+	// piling up batches, or give the batch up with http.backpressure=drop
+	if a.inflightSlots != nil {
+		if a.backpressure == backpressureDrop {
+			select {
+			case a.inflightSlots <- struct{}{}:
+			default:
+				a.shed(buffer, spooled, bufferBytes)
+				return
+			}
+		} else {
+			a.inflightSlots <- struct{}{}
+		}
 	}
-
+	a.inflight.Add(1)
 	go func() {
-		// Create the request and send it on its way
-		request := createRequest(a.url, a.useGzip, string(payload))
+		defer a.inflight.Done()
+		if a.inflightSlots != nil {
+			defer func() { <-a.inflightSlots }()
+		}
+		defer a.memory.release(bufferBytes)
+
 		start := time.Now()
-		response, err := a.client.Do(request)
-		if err != nil {
-			debug("http - error on client.Do:", err, a.url)
-			// TODO @raychaser - now what?
-			if a.crash {
-				die("http - error on client.Do:", err, a.url)
-			} else {
-				debug("http: error on client.Do:", err)
+		if err := a.sendWithRetry(buffer); err != nil {
+			debug("http: route:", a.route.ID, err, a.route.Address)
+			buffer = a.settle(buffer)
+
+			// Merge the batch into the next flush while the endpoint recovers,
+			// a rejected one would fail again
+			if !a.crash && !rejected(err) {
+				if buffer = a.requeue(buffer); len(buffer) == 0 {
+					a.spool.remove(spooled)
+					return
+				}
 			}
-		}
-		if response.StatusCode != 200 {
-			debug("http: response not 200 but", response.StatusCode)
-			// TODO @raychaser - now what?
+
+			// Keep the batch for a later replay and divert it, even when
+			// crashing; the spooled one is replayed on the next start unless
+			// written
+			if a.deadletter.write(buffer) {
+				a.spool.remove(spooled)
+			}
+			a.divert(buffer)
 			if a.crash {
-				die("http: response not 200 but", response.StatusCode)
+				die("http: route:", a.route.ID, err, a.route.Address)
 			}
+			a.audit.recordBatch(buffer, dropFailed)
+			a.metrics.count("dropped", int64(len(buffer)), "reason", dropFailed)
+			return
 		}
 
-		// Make sure the entire response body is read so the HTTP
-		// connection can be reused
-		io.Copy(ioutil.Discard, response.Body)
-		response.Body.Close()
+		a.spool.remove(spooled)
+		a.metrics.count("shipped", int64(len(a.settle(buffer))))
 
 		// Bookkeeping, logging
 		timeAll := time.Since(start)
-		a.totalMessageCount += len(buffer)
-		debug("http: flushed:", reason, "messages:", len(buffer),
-			"in:", timeAll, "total:", a.totalMessageCount)
+		total := atomic.AddInt64(&a.totalMessageCount, int64(len(buffer)))
+		debug("http: route:", a.route.ID, "flushed:", reason, "messages:", len(buffer),
+			"in:", timeAll, "total:", total)
 	}()
 }
 
-// Create the request based on whether GZIP compression is to be used
-func createRequest(url string, useGzip bool, payload string) *http.Request {
-	var request *http.Request
-	if useGzip {
-		gzipBuffer := new(bytes.Buffer)
-		gzipWriter := gzip.NewWriter(gzipBuffer)
-		_, err := gzipWriter.Write([]byte(payload))
-		if err != nil {
-			// TODO @raychaser - now what?
-			die("http: unable to write to GZIP writer:", err)
+// Give up a batch the endpoint has no room for, through the failure path
+func (a *HTTPAdapter) shed(buffer []*map[string]interface{}, spooled string, bufferBytes int64) {
+	debug("http: route:", a.route.ID, "endpoint busy, dropping messages:", len(buffer))
+	a.audit.recordBatch(buffer, dropBackpressure)
+	a.metrics.count("dropped", int64(len(buffer)), "reason", dropBackpressure)
+	a.deadletter.write(buffer)
+	a.divert(buffer)
+	a.spool.remove(spooled)
+	a.memory.release(bufferBytes)
+}
+
+// Hold the events of a failed batch for the next flush, up to
+// http.requeue.max events, returning the oldest ones which did not fit
+func (a *HTTPAdapter) requeue(buffer []*map[string]interface{}) []*map[string]interface{} {
+	a.bufferMutex.Lock()
+	space := a.requeueMax - len(a.requeued)
+	if space <= 0 {
+		a.bufferMutex.Unlock()
+		return buffer
+	}
+	if space > len(buffer) {
+		space = len(buffer)
+	}
+	rest, kept := buffer[:len(buffer)-space], buffer[len(buffer)-space:]
+
+	// Journal them again as the batch file is removed
+	var size int64
+	for _, data := range kept {
+		size += eventSize(*data)
+		a.spool.append(data)
+	}
+	a.requeued = append(a.requeued, kept...)
+	a.requeuedBytes += size
+	waiting := len(a.requeued)
+	a.bufferMutex.Unlock()
+
+	// The budget mutex is taken before the buffer one when reserving
+	a.memory.hold(size)
+	a.metrics.count("requeued", int64(len(kept)))
+	debug("http: route:", a.route.ID, "requeued:", len(kept), "waiting:", waiting)
+
+	return rest
+}
+
+// rejectedError is a 4xx response, sending the same payload again cannot
+// fix it so the batch is not retried
+type rejectedError struct {
+	status int
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("response not 2xx but %d, rejected", e.status)
+}
+
+// Whether an error is a rejection of the payload by the endpoint
+func rejected(err error) bool {
+	_, ok := err.(*rejectedError)
+	return ok
+}
+
+// Send a batch, retrying with exponential backoff when it fails
+func (a *HTTPAdapter) sendWithRetry(buffer []*map[string]interface{}) error {
+	// The events of a batch are counted once, whatever its retries
+	a.eventLimit.wait(len(buffer))
+
+	delay := a.retryInitial
+	err := a.deliver(buffer)
+
+	for attempt := 1; err != nil && !rejected(err) && attempt <= a.retryMax; attempt++ {
+		debug("http: route:", a.route.ID, "retry", attempt, "of", a.retryMax, "in", delay, "after:", err)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > a.retryMaxDelay {
+			delay = a.retryMaxDelay
 		}
-		err = gzipWriter.Close()
+		err = a.deliver(buffer)
+	}
+
+	return err
+}
+
+// Hand a batch to the sink, a send counting as one request of
+// http.rate.limit unless the sink is the adapter itself, which counts each
+// of its requests, with or without injected faults
+func (a *HTTPAdapter) deliver(buffer []*map[string]interface{}) error {
+	target := a.sink
+	if faulty, ok := target.(*faultySink); ok {
+		target = faulty.sink
+	}
+	if target != sink(a) {
+		a.requestLimit.wait(1)
+	}
+
+	return a.sink.send(buffer)
+}
+
+// Send a batch in the requests shaped by the format of the adapter
+func (a *HTTPAdapter) send(buffer []*map[string]interface{}) error {
+	payloads, err := a.encode(buffer)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	if a.instance != "" {
+		ids = batchIDs(buffer, len(payloads))
+	}
+
+	for i, payload := range payloads {
+		for payload != nil {
+			if ids != nil {
+				payload.batchID = ids[i]
+			}
+			if payload.attempt > 0 {
+				time.Sleep(time.Duration(payload.attempt) * time.Second)
+			}
+			if payload, err = a.post(payload); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Encode a batch, splitting it in halves until each payload is within
+// http.payload.maxbytes; an event too large on its own is sent as is
+func (a *HTTPAdapter) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	payloads, err := a.format.encode(buffer)
+	if err != nil || a.payloadMaxBytes <= 0 || len(buffer) < 2 {
+		return payloads, err
+	}
+
+	for _, payload := range payloads {
+		if len(payload.body) > a.payloadMaxBytes {
+			half := len(buffer) / 2
+			first, err := a.encode(buffer[:half])
+			if err != nil {
+				return nil, err
+			}
+			second, err := a.encode(buffer[half:])
+			if err != nil {
+				return nil, err
+			}
+			return append(first, second...), nil
+		}
+	}
+
+	return payloads, nil
+}
+
+// POST a payload to the endpoint, returning the payload to retry if any
+func (a *HTTPAdapter) post(payload *httpPayload) (*httpPayload, error) {
+	a.requestLimit.wait(1)
+
+	url := payload.url
+	if url == "" {
+		url = a.url
+	}
+
+	// Create the request and send it on its way
+	request := createRequest(a.method, url, a.compression, string(payload.body))
+	if payload.contentType != "" {
+		request.Header.Set("Content-Type", payload.contentType)
+	}
+	if a.authorization != "" {
+		request.Header.Set("Authorization", a.authorization)
+	}
+	for k, v := range payload.header {
+		request.Header[k] = v
+	}
+	for k, v := range a.headers {
+		request.Header[k] = v
+	}
+	if payload.batchID != "" {
+		request.Header.Set("X-Batch-Id", payload.batchID)
+	}
+	if signer, ok := a.format.(requestSigner); ok {
+		if err := signer.sign(request); err != nil {
+			return nil, fmt.Errorf("error signing request: %s", err)
+		}
+	}
+	if os.Getenv("DEBUG") != "" {
+		request = request.WithContext(httptrace.WithClientTrace(request.Context(),
+			&httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+				debug("http: got connection, reused:", info.Reused, "idle:", info.WasIdle)
+			}}))
+	}
+	response, err := a.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error on client.Do: %s", err)
+	}
+	debug("http: response", response.Proto, response.StatusCode)
+
+	// Make sure the entire response body is read so the HTTP
+	// connection can be reused
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		if response.StatusCode >= 400 && response.StatusCode < 500 &&
+			response.StatusCode != http.StatusRequestTimeout && response.StatusCode != http.StatusTooManyRequests {
+			return nil, &rejectedError{status: response.StatusCode}
+		}
+		return nil, fmt.Errorf("response not 2xx but %d", response.StatusCode)
+	}
+
+	// Some endpoints report errors in the body of successful responses
+	if checker, ok := a.format.(responseChecker); ok {
+		return checker.check(payload, body)
+	}
+
+	return nil, nil
+}
+
+// Compress a payload, the name of a compressor is its Content-Encoding
+type compressor func(payload []byte) ([]byte, error)
+
+var compressors = map[string]compressor{
+	"gzip":   compressGzip,
+	"zstd":   compressZstd,
+	"snappy": compressSnappy,
+}
+
+func compressGzip(payload []byte) ([]byte, error) {
+	gzipBuffer := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(gzipBuffer)
+	if _, err := gzipWriter.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return gzipBuffer.Bytes(), nil
+}
+
+func compressZstd(payload []byte) ([]byte, error) {
+	return zstdEncoder.EncodeAll(payload, nil), nil
+}
+
+// Snappy bodies use the framing format, not a bare block
+func compressSnappy(payload []byte) ([]byte, error) {
+	snappyBuffer := new(bytes.Buffer)
+	snappyWriter := snappy.NewBufferedWriter(snappyBuffer)
+	if _, err := snappyWriter.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := snappyWriter.Close(); err != nil {
+		return nil, err
+	}
+	return snappyBuffer.Bytes(), nil
+}
+
+// Create the request based on the method and the compression to use
+func createRequest(method string, url string, compression string, payload string) *http.Request {
+	var request *http.Request
+	if compress, ok := compressors[compression]; ok {
+		body, err := compress([]byte(payload))
 		if err != nil {
 			// TODO @raychaser - now what?
-			die("http: unable to close GZIP writer:", err)
+			die("http: unable to compress with", compression, err)
 		}
-		request, err = http.NewRequest("POST", url, gzipBuffer)
+		request, err = http.NewRequest(method, url, bytes.NewReader(body))
 		if err != nil {
 			debug("http: error on http.NewRequest:", err, url)
 			// TODO @raychaser - now what?
 			die("", "http: error on http.NewRequest:", err, url)
 		}
-		request.Header.Set("Content-Encoding", "gzip")
+		request.Header.Set("Content-Encoding", compression)
 	} else {
 		var err error
-		request, err = http.NewRequest("POST", url, strings.NewReader(payload))
+		request, err = http.NewRequest(method, url, strings.NewReader(payload))
 		if err != nil {
 			debug("http: error on http.NewRequest:", err, url)
 			// TODO @raychaser - now what?
@@ -283,14 +1123,17 @@ func createRequest(url string, useGzip bool, payload string) *http.Request {
 	return request
 }
 
-// Parse the logstash fields env variables
-func GetLogstashFields(c *docker.Container, a *HTTPAdapter) map[string]string {
-	if fields, ok := a.logstashFields[c.ID]; ok {
-		return fields
-	}
+// Logstash fields of a container with the LOGSTASH_FIELDS value they were
+// parsed from
+type fieldsCacheEntry struct {
+	source  string
+	fields  map[string]interface{}
+	expires time.Time
+}
 
+// Parse the logstash fields env variables
+func GetLogstashFields(c *docker.Container, a *HTTPAdapter) map[string]interface{} {
 	fieldsStr := os.Getenv("LOGSTASH_FIELDS")
-	fields := map[string]string{}
 
 	for _, e := range c.Config.Env {
 		if strings.HasPrefix(e, "LOGSTASH_FIELDS=") {
@@ -298,15 +1141,98 @@ func GetLogstashFields(c *docker.Container, a *HTTPAdapter) map[string]string {
 		}
 	}
 
-	if len(fieldsStr) > 0 {
-		for _, f := range strings.Split(fieldsStr, ",") {
-			sp := strings.Split(f, "=")
-			k, v := sp[0], sp[1]
-			fields[k] = v
-		}
+	a.fieldsMutex.Lock()
+	defer a.fieldsMutex.Unlock()
+
+	// Parse again when the container was redeployed with other values or
+	// the cached fields expired
+	if entry, ok := a.logstashFields[c.ID]; ok && entry.source == fieldsStr &&
+		(a.fieldsTTL == 0 || time.Now().Before(entry.expires)) {
+		return entry.fields
 	}
 
-	a.logstashFields[c.ID] = fields
+	fields := map[string]interface{}{}
+
+	// The route fields are defaults the environment can override
+	parseLogstashFields(fields, a.routeFields)
+	parseLogstashFields(fields, fieldsStr)
+	fields = a.parser.normalize(fields)
+
+	a.logstashFields[c.ID] = &fieldsCacheEntry{
+		source:  fieldsStr,
+		fields:  fields,
+		expires: time.Now().Add(a.fieldsTTL),
+	}
 
 	return fields
 }
+
+// Release the cached data of a container
+func (a *HTTPAdapter) forgetContainer(containerID string) {
+	a.fieldsMutex.Lock()
+	delete(a.logstashFields, containerID)
+	a.fieldsMutex.Unlock()
+
+	a.rancher.DeleteFromCache(containerID)
+	recent.forget(containerID)
+}
+
+// Parse comma separated key=value pairs, a key can declare the type of its
+// value as in replicas:int=3 or canary:bool=true
+func parseLogstashFields(fields map[string]interface{}, fieldsStr string) {
+	if len(fieldsStr) == 0 {
+		return
+	}
+
+	for _, f := range strings.Split(fieldsStr, ",") {
+		sp := strings.SplitN(f, "=", 2)
+		if len(sp) != 2 {
+			debug("http: invalid logstash field:", f)
+			continue
+		}
+		k, v := sp[0], sp[1]
+
+		if i := strings.LastIndex(k, ":"); i >= 0 {
+			value, err := coerceFieldValue(k[i+1:], v)
+			if err == nil {
+				setFieldPath(fields, k[:i], value)
+				continue
+			}
+			debug("http: invalid logstash field:", f, err)
+		}
+
+		setFieldPath(fields, k, v)
+	}
+}
+
+// Convert a field value to the declared type
+func coerceFieldValue(fieldType string, value string) (interface{}, error) {
+	switch fieldType {
+	case "int":
+		return strconv.ParseInt(value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	case "string":
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("unknown field type %q", fieldType)
+}
+
+// Set a field, dotted keys like app.tier create nested objects
+func setFieldPath(fields map[string]interface{}, key string, value interface{}) {
+	path := strings.Split(key, ".")
+
+	for _, p := range path[:len(path)-1] {
+		nested, ok := fields[p].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			fields[p] = nested
+		}
+		fields = nested
+	}
+
+	fields[path[len(path)-1]] = value
+}
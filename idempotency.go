@@ -0,0 +1,75 @@
+package logspoutRancher
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// Delivery data for event data, unique to each event of a route
+type DeliveryInfo struct {
+	ID       string `json:"id"`
+	Instance string `json:"instance"`
+	Seq      int64  `json:"seq"`
+}
+
+// A random UUID, version 4
+func newUUID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return formatUUID(id, 4)
+}
+
+// Format 16 bytes as a UUID of a version
+func formatUUID(id []byte, version byte) string {
+	id[6] = id[6]&0x0f | version<<4
+	id[8] = id[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// Number an event, the ID being the instance of the adapter and the rank of
+// the event in it
+func (a *HTTPAdapter) stampDelivery(data map[string]interface{}) {
+	seq := atomic.AddInt64(&a.sequence, 1)
+	data["delivery"] = DeliveryInfo{
+		ID:       a.instance + "-" + strconv.FormatInt(seq, 10),
+		Instance: a.instance,
+		Seq:      seq,
+	}
+}
+
+// The delivery ID of an event, also once read back from a spool
+func deliveryID(data map[string]interface{}) string {
+	switch delivery := data["delivery"].(type) {
+	case DeliveryInfo:
+		return delivery.ID
+	case map[string]interface{}:
+		id, _ := delivery["id"].(string)
+		return id
+	}
+
+	return ""
+}
+
+// The IDs of the payloads of a batch, derived from the delivery IDs of its
+// events so a retried payload keeps its ID
+func batchIDs(buffer []*map[string]interface{}, payloads int) []string {
+	hash := sha256.New()
+	for _, data := range buffer {
+		hash.Write([]byte(deliveryID(*data)))
+		hash.Write([]byte{0})
+	}
+	sum := hash.Sum(nil)
+
+	ids := make([]string, payloads)
+	for i := range ids {
+		id := sha256.Sum256(append(sum, []byte(strconv.Itoa(i))...))
+		ids[i] = formatUUID(id[:16], 5)
+	}
+
+	return ids
+}
@@ -0,0 +1,97 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Syslog priorities of the journal entries, by lowercased level
+var journalPriorities = map[string]int{
+	"panic": 0, "fatal": 2, "critical": 2, "error": 3, "err": 3,
+	"warn": 4, "warning": 4, "notice": 5, "info": 6, "debug": 7, "trace": 7,
+}
+
+// journaldSink writes events to the journal of the host with structured
+// fields, so the journal upload of the host ships them
+type journaldSink struct {
+	writer     *journaldWriter
+	messageKey string
+	levelKey   string
+}
+
+// NewJournaldAdapter creates an adapter writing to the journal, e.g.
+// journald:// or journald:///run/systemd/journal/socket
+func NewJournaldAdapter(route *router.Route) (router.LogAdapter, error) {
+	socket := route.Address
+	if socket == "" || socket == "/" {
+		socket = journaldSocket
+	}
+
+	writer, err := newJournaldWriter(socket)
+	if err != nil {
+		return nil, fmt.Errorf("journald: cannot connect to %s: %s", socket, err)
+	}
+	debug("journald:", socket)
+
+	adapter := newAdapter(route)
+	adapter.sink = &journaldSink{
+		writer:     writer,
+		messageKey: adapter.parser.messageKey,
+		levelKey:   getStringParameter(route.Options, "journald.level_key", "level"),
+	}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Write an entry per event, the message of the event is the MESSAGE and
+// the whole event is LOGSPOUT_EVENT
+func (s *journaldSink) send(buffer []*map[string]interface{}) error {
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		meta := newTemplateData(*data)
+		message, ok := (*data)[s.messageKey].(string)
+		if !ok {
+			message = string(event)
+		}
+		priority, ok := journalPriorities[lineLevel(*data, s.levelKey, s.messageKey)]
+		if !ok {
+			priority = 6
+		}
+
+		fields := [][2]string{
+			{"MESSAGE", message},
+			{"PRIORITY", strconv.Itoa(priority)},
+			{"SYSLOG_IDENTIFIER", meta.Service},
+			{"CONTAINER_ID", shortContainerId(meta.ContainerID)},
+			{"CONTAINER_ID_FULL", meta.ContainerID},
+			{"CONTAINER_NAME", meta.Container},
+			{"IMAGE_NAME", meta.Image},
+			{"RANCHER_STACK", meta.Stack},
+			{"RANCHER_SERVICE", meta.Service},
+			{"LOGSPOUT_EVENT", string(event)},
+		}
+
+		if _, err := s.writer.writeFields(fields); err != nil {
+			return fmt.Errorf("error writing to the journal: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// The 12 characters container ID docker's journald driver uses
+func shortContainerId(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
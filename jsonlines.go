@@ -0,0 +1,163 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Attempts to write a batch, reconnecting in between
+const socketAttempts = 3
+
+// socketSink writes framed events to a TCP, TLS or UDP socket,
+// reconnecting when the connection drops
+type socketSink struct {
+	name    string
+	network string
+	address string
+	timeout time.Duration
+	encode  func(data *map[string]interface{}) ([]byte, error)
+	conn    net.Conn
+	mutex   sync.Mutex
+}
+
+// NewJSONLinesAdapter creates an adapter writing to a socket, e.g.
+// json+tcp://vector:9000, json+udp://fluentbit:5170 or json+tls://host:6514
+func NewJSONLinesAdapter(route *router.Route) (router.LogAdapter, error) {
+	network, err := jsonLinesNetwork(route)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSocketSink("json", network, route.Address,
+		getDurationParameter(route.Options, "json.timeout", 10*time.Second), jsonLine)
+
+	adapter := newAdapter(route)
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Network of a route, from its transport or, for the tcp+json and udp+json
+// spellings, from its adapter type
+func jsonLinesNetwork(route *router.Route) (string, error) {
+	network := route.AdapterTransport("tcp")
+	if adapterType := route.AdapterType(); adapterType == "tcp" || adapterType == "udp" {
+		network = adapterType
+	}
+	if network != "tcp" && network != "udp" && network != "tls" {
+		return "", fmt.Errorf("json: unsupported transport: %s", network)
+	}
+
+	return network, nil
+}
+
+// Create a socket sink and try to connect it, a failed connection is
+// retried on the first batch
+func newSocketSink(name string, network string, address string, timeout time.Duration,
+	encode func(data *map[string]interface{}) ([]byte, error)) *socketSink {
+
+	s := &socketSink{
+		name:    name,
+		network: network,
+		address: address,
+		timeout: timeout,
+		encode:  encode,
+	}
+	if err := s.connect(); err != nil {
+		debug(name+": cannot connect, will retry:", err)
+	}
+	debug(name+":", network, address)
+
+	return s
+}
+
+// Encode an event as a JSON line
+func jsonLine(data *map[string]interface{}) ([]byte, error) {
+	event, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	return append(event, '\n'), nil
+}
+
+func (s *socketSink) connect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: s.timeout}
+	if s.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.address, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial(s.network, s.address)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+
+	return nil
+}
+
+// Write the batch, a datagram per event over UDP
+func (s *socketSink) send(buffer []*map[string]interface{}) error {
+	var lines [][]byte
+	for _, data := range buffer {
+		line, err := s.encode(data)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, line)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var err error
+	for attempt := 0; attempt < socketAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				continue
+			}
+		}
+
+		if err = s.write(lines); err == nil {
+			return nil
+		}
+		debug(s.name+": write failed, reconnecting:", err)
+		s.connect()
+	}
+
+	return fmt.Errorf("cannot write to %s: %s", s.address, err)
+}
+
+func (s *socketSink) write(lines [][]byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+
+	if s.network == "udp" {
+		for _, line := range lines {
+			if _, err := s.conn.Write(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err := s.conn.Write(bytes.Join(lines, nil))
+	return err
+}
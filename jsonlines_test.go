@@ -0,0 +1,31 @@
+package logspoutRancher
+
+import (
+	"testing"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+func TestJSONLinesNetwork(t *testing.T) {
+	for adapter, expected := range map[string]string{
+		"json":     "tcp",
+		"json+tcp": "tcp",
+		"json+udp": "udp",
+		"json+tls": "tls",
+		"tcp":      "tcp",
+		"udp":      "udp",
+		"tcp+json": "tcp",
+		"udp+json": "udp",
+	} {
+		network, err := jsonLinesNetwork(&router.Route{Adapter: adapter})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", adapter, err)
+		} else if network != expected {
+			t.Errorf("%s: expected %s, got %s", adapter, expected, network)
+		}
+	}
+
+	if _, err := jsonLinesNetwork(&router.Route{Adapter: "json+quic"}); err == nil {
+		t.Error("json+quic: expected an error")
+	}
+}
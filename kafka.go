@@ -0,0 +1,102 @@
+package logspoutRancher
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaSink publishes events to a Kafka topic, keyed so the lines of a
+// container or a service land in the same partition
+type kafkaSink struct {
+	writer *kafka.Writer
+	topic  *template.Template
+	key    string
+}
+
+// NewKafkaAdapter creates an adapter publishing to kafka://broker:9092,
+// several brokers are separated by commas
+func NewKafkaAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newAdapter(route)
+
+	key := getStringParameter(route.Options, "kafka.key", "container")
+	if key != "container" && key != "service" && key != "none" {
+		return nil, fmt.Errorf("kafka: kafka.key must be container, service or none: %s", key)
+	}
+
+	// Writes wait for every in-sync replica, batches follow the buffer
+	// settings of the adapter
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(route.Address, ",")...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchSize:    adapter.capacity,
+		BatchTimeout: adapter.timeout,
+	}
+
+	// kafka+ssl://broker:9093 connects over TLS
+	if route.AdapterTransport("") == "ssl" {
+		writer.Transport = &kafka.Transport{TLS: &tls.Config{
+			InsecureSkipVerify: getStringParameter(route.Options, "kafka.tls.skipverify", "false") == "true",
+		}}
+	}
+	debug("kafka: brokers:", route.Address, "key:", key)
+
+	adapter.sink = &kafkaSink{
+		writer: writer,
+		topic:  parseTemplate("kafka.topic", getStringParameter(route.Options, "kafka.topic", "logs")),
+		key:    key,
+	}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Key of an event, the container ID or the Rancher service ID
+func (s *kafkaSink) messageKey(data map[string]interface{}) []byte {
+	switch s.key {
+	case "container":
+		if id := newTemplateData(data).ContainerID; id != "" {
+			return []byte(id)
+		}
+	case "service":
+		if info, ok := data["rancher"].(*RancherInfo); (ok || decoded(data["rancher"], &info)) && info.Stack != nil &&
+			info.Stack.ServiceId != "" {
+			return []byte(info.Stack.ServiceId)
+		}
+		meta := newTemplateData(data)
+		return []byte(meta.Stack + "/" + meta.Service)
+	}
+
+	return nil
+}
+
+// Publish the batch and wait for the brokers to acknowledge every event
+func (s *kafkaSink) send(buffer []*map[string]interface{}) error {
+	messages := make([]kafka.Message, 0, len(buffer))
+
+	for _, data := range buffer {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		messages = append(messages, kafka.Message{
+			Topic: renderTemplate(s.topic, *data),
+			Key:   s.messageKey(*data),
+			Value: payload,
+		})
+	}
+
+	if err := s.writer.WriteMessages(context.Background(), messages...); err != nil {
+		return fmt.Errorf("error on publish: %s", err)
+	}
+
+	return nil
+}
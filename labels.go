@@ -0,0 +1,88 @@
+package logspoutRancher
+
+import (
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Docker Swarm service data for event data
+type SwarmInfo struct {
+	Service   string `json:"service,omitempty"`
+	ServiceID string `json:"serviceId,omitempty"`
+	Task      string `json:"task,omitempty"`
+	TaskID    string `json:"taskId,omitempty"`
+	Stack     string `json:"stack,omitempty"`
+	Node      string `json:"node,omitempty"`
+}
+
+// Get the swarm metadata from the container labels, nil when the container
+// is not a swarm task
+func GetSwarmInfo(c *docker.Container) *SwarmInfo {
+	labels := c.Config.Labels
+
+	info := &SwarmInfo{
+		Service:   labels["com.docker.swarm.service.name"],
+		ServiceID: labels["com.docker.swarm.service.id"],
+		Task:      labels["com.docker.swarm.task.name"],
+		TaskID:    labels["com.docker.swarm.task.id"],
+		Stack:     labels["com.docker.stack.namespace"],
+		Node:      labels["com.docker.swarm.node.id"],
+	}
+
+	if *info == (SwarmInfo{}) {
+		return nil
+	}
+
+	return info
+}
+
+// Kubernetes pod data for event data
+type KubernetesInfo struct {
+	Pod       string `json:"pod,omitempty"`
+	PodUID    string `json:"podUid,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Container string `json:"container,omitempty"`
+}
+
+// Get the pod metadata from the labels kubelet sets, nil when the container
+// was not created by kubelet
+func GetKubernetesInfo(c *docker.Container) *KubernetesInfo {
+	labels := c.Config.Labels
+
+	info := &KubernetesInfo{
+		Pod:       labels["io.kubernetes.pod.name"],
+		PodUID:    labels["io.kubernetes.pod.uid"],
+		Namespace: labels["io.kubernetes.pod.namespace"],
+		Container: labels["io.kubernetes.container.name"],
+	}
+
+	if info.Pod == "" && info.Namespace == "" {
+		return nil
+	}
+
+	return info
+}
+
+// Docker Compose project data for event data
+type ComposeInfo struct {
+	Project string `json:"project,omitempty"`
+	Service string `json:"service,omitempty"`
+	Number  string `json:"number,omitempty"`
+}
+
+// Get the compose project from the container labels, nil when the container
+// was not created by docker-compose
+func GetComposeInfo(c *docker.Container) *ComposeInfo {
+	labels := c.Config.Labels
+
+	info := &ComposeInfo{
+		Project: labels["com.docker.compose.project"],
+		Service: labels["com.docker.compose.service"],
+		Number:  labels["com.docker.compose.container-number"],
+	}
+
+	if info.Project == "" && info.Service == "" {
+		return nil
+	}
+
+	return info
+}
@@ -0,0 +1,164 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Events buffered for a live tail client before its events are dropped
+const liveTailBuffer = 256
+
+// liveTailHub fans the events of the routes with http.livetail out to the
+// WebSocket clients of /tail, e.g. ws://host/tail?stack=web&service=nginx
+type liveTailHub struct {
+	clients map[*liveTailClient]bool
+	mutex   sync.RWMutex
+}
+
+// A client of the live tail and the stack, service and container it follows
+type liveTailClient struct {
+	stack     string
+	service   string
+	container string
+	events    chan []byte
+}
+
+var liveTail = &liveTailHub{clients: make(map[*liveTailClient]bool)}
+
+var liveTailUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// NewLiveTailHandler serves the live tail WebSocket
+func NewLiveTailHandler() http.Handler {
+	return http.HandlerFunc(liveTail.serve)
+}
+
+func (h *liveTailHub) serve(w http.ResponseWriter, r *http.Request) {
+	conn, err := liveTailUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		debug("http: livetail: cannot upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	query := r.URL.Query()
+	client := &liveTailClient{
+		stack:     query.Get("stack"),
+		service:   query.Get("service"),
+		container: query.Get("container"),
+		events:    make(chan []byte, liveTailBuffer),
+	}
+	h.mutex.Lock()
+	h.clients[client] = true
+	h.mutex.Unlock()
+	defer func() {
+		h.mutex.Lock()
+		delete(h.clients, client)
+		h.mutex.Unlock()
+	}()
+	debug("http: livetail: client", r.RemoteAddr, "stack:", client.stack, "service:", client.service)
+
+	// Notice the client going away
+	closed := make(chan struct{})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event := <-client.events:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Whether a client follows the event
+func (c *liveTailClient) follows(meta *templateData) bool {
+	return (c.stack == "" || c.stack == meta.Stack) &&
+		(c.service == "" || c.service == meta.Service) &&
+		(c.container == "" || c.container == meta.Container || c.container == meta.ContainerID)
+}
+
+// Send an event to the clients following it, the events of slow clients are
+// dropped so the logs are never held back
+func (h *liveTailHub) publish(data map[string]interface{}) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if len(h.clients) == 0 {
+		return
+	}
+
+	meta := newTemplateData(data)
+	var event []byte
+	for client := range h.clients {
+		if !client.follows(meta) {
+			continue
+		}
+		if event == nil {
+			var err error
+			if event, err = json.Marshal(data); err != nil {
+				debug("http: livetail: error encoding JSON:", err)
+				return
+			}
+		}
+
+		select {
+		case client.events <- event:
+		default:
+		}
+	}
+}
+
+// Queue an event of the route for the remote WebSocket, dropping it when
+// the connection can't keep up
+func (a *HTTPAdapter) forwardLiveTail(data map[string]interface{}) {
+	event, err := json.Marshal(data)
+	if err != nil {
+		debug("http: livetail: error encoding JSON:", err)
+		return
+	}
+
+	select {
+	case a.liveTailRemote <- event:
+	default:
+	}
+}
+
+// Stream the events of the route to a remote WebSocket, reconnecting when
+// the connection drops
+func (a *HTTPAdapter) streamLiveTail(url string) {
+	for {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			debug("http: livetail: cannot connect:", err, url)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		debug("http: livetail: connected to", url)
+
+		for event := range a.liveTailRemote {
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, event); err != nil {
+				debug("http: livetail: connection lost:", err, url)
+				break
+			}
+		}
+		conn.Close()
+	}
+}
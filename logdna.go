@@ -0,0 +1,119 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// logdnaFormat posts lines to the Mezmo (LogDNA) ingest endpoint, the host
+// is a parameter of the request so lines are grouped by hostname
+type logdnaFormat struct {
+	url        string
+	header     http.Header
+	hostname   *template.Template
+	app        *template.Template
+	levelKey   string
+	messageKey string
+}
+
+// A line of an ingest request
+type logdnaLine struct {
+	Timestamp int64                  `json:"timestamp"`
+	Line      string                 `json:"line"`
+	App       string                 `json:"app,omitempty"`
+	Level     string                 `json:"level,omitempty"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+}
+
+// NewLogDNAAdapter creates an adapter ingesting into Mezmo, e.g.
+// logdna://logs.logdna.com
+func NewLogDNAAdapter(route *router.Route) (router.LogAdapter, error) {
+	key := getStringParameter(route.Options, "logdna.key", "")
+	if key == "" {
+		return nil, fmt.Errorf("logdna: logdna.key is required")
+	}
+
+	adapter := newHTTPAdapter(route)
+	format := &logdnaFormat{
+		url:        adapter.url + "/logs/ingest",
+		header:     http.Header{},
+		hostname:   parseTemplate("logdna.hostname", getStringParameter(route.Options, "logdna.hostname", "{{.Hostname}}")),
+		app:        parseTemplate("logdna.app", getStringParameter(route.Options, "logdna.app", "{{.Stack}}/{{.Service}}")),
+		levelKey:   getStringParameter(route.Options, "logdna.level_key", "level"),
+		messageKey: adapter.parser.messageKey,
+	}
+
+	// The ingestion key is the user of basic authentication
+	request := &http.Request{Header: http.Header{}}
+	request.SetBasicAuth(key, "")
+	format.header.Set("Authorization", request.Header.Get("Authorization"))
+	debug("logdna: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as one request per hostname, the message is the line
+// and the rest of the event its meta
+func (f *logdnaFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	lines := make(map[string][]logdnaLine)
+	var hostnames []string
+
+	for _, data := range buffer {
+		line := logdnaLine{
+			Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+			App:       renderTemplate(f.app, *data),
+			Meta:      make(map[string]interface{}, len(*data)),
+		}
+		for k, v := range *data {
+			switch k {
+			case f.messageKey:
+				line.Line = fmt.Sprint(v)
+			case "@timestamp":
+				if t, ok := v.(time.Time); ok {
+					line.Timestamp = t.UnixNano() / int64(time.Millisecond)
+				}
+			default:
+				line.Meta[k] = v
+			}
+		}
+		if level, ok := (*data)[f.levelKey].(string); ok {
+			line.Level = level
+		}
+
+		hostname := renderTemplate(f.hostname, *data)
+		if _, ok := lines[hostname]; !ok {
+			hostnames = append(hostnames, hostname)
+		}
+		lines[hostname] = append(lines[hostname], line)
+	}
+
+	payloads := make([]*httpPayload, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		body, err := json.Marshal(map[string]interface{}{"lines": lines[hostname]})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		query := url.Values{}
+		query.Set("hostname", hostname)
+		query.Set("now", strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10))
+		payloads = append(payloads, &httpPayload{
+			url:         f.url + "?" + query.Encode(),
+			contentType: "application/json",
+			header:      f.header,
+			body:        body,
+		})
+	}
+
+	return payloads, nil
+}
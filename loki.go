@@ -0,0 +1,99 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// lokiFormat pushes events to Grafana Loki, streamed by stack, service and
+// container
+type lokiFormat struct {
+	url    string
+	header http.Header
+}
+
+// A stream of a push request, its values are [timestamp, line] pairs
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// NewLokiAdapter creates an adapter pushing to Loki, e.g. loki://loki:3100
+// or loki+https://logs-prod-us-central1.grafana.net
+func NewLokiAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newHTTPAdapter(route)
+
+	format := &lokiFormat{
+		url:    adapter.url + "/loki/api/v1/push",
+		header: http.Header{},
+	}
+
+	// Tenant of a multitenant cluster
+	if tenant := getStringParameter(route.Options, "loki.tenant", ""); tenant != "" {
+		format.header.Set("X-Scope-OrgID", tenant)
+	}
+	debug("loki: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as one stream per stack, service and container, each
+// line is the JSON event stamped with its @timestamp
+func (f *lokiFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	streams := make(map[[3]string]*lokiStream)
+	var keys [][3]string
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		timestamp := time.Now()
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			timestamp = t
+		}
+
+		meta := newTemplateData(*data)
+		key := [3]string{meta.Stack, meta.Service, meta.Container}
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: map[string]string{
+				"stack":     meta.Stack,
+				"service":   meta.Service,
+				"container": meta.Container,
+			}}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+		stream.Values = append(stream.Values,
+			[2]string{strconv.FormatInt(timestamp.UnixNano(), 10), string(event)})
+	}
+
+	request := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range keys {
+		request.Streams = append(request.Streams, streams[key])
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	return []*httpPayload{{
+		url:         f.url,
+		contentType: "application/json",
+		header:      f.header,
+		body:        payload,
+	}}, nil
+}
@@ -0,0 +1,151 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// loopbackCollector is an embedded HTTP endpoint receiving the batches of
+// the adapter, it validates and pretty-prints them so a configuration can
+// be verified end to end without a real collector
+type loopbackCollector struct {
+	listener net.Listener
+	batches  int64
+}
+
+// Start a collector on an address, e.g. 127.0.0.1:0 for a free port
+func startLoopbackCollector(address string) (*loopbackCollector, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &loopbackCollector{listener: listener}
+	go http.Serve(listener, c)
+	log.Println("http: loopback collector listening on", listener.Addr())
+
+	return c, nil
+}
+
+// Base URL of the collector
+func (c *loopbackCollector) url() string {
+	return "http://" + c.listener.Addr().String()
+}
+
+func (c *loopbackCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	batch := atomic.AddInt64(&c.batches, 1)
+	prefix := fmt.Sprintf("loopback: batch %d: %s %s", batch, r.Method, r.URL.RequestURI())
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			log.Println(prefix, "invalid gzip body:", err)
+			http.Error(w, "invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer reader.Close()
+		body = reader
+	} else if r.Header.Get("Content-Encoding") == "zstd" {
+		reader, err := zstd.NewReader(r.Body)
+		if err != nil {
+			log.Println(prefix, "invalid zstd body:", err)
+			http.Error(w, "invalid zstd body", http.StatusBadRequest)
+			return
+		}
+		defer reader.Close()
+		body = reader
+	} else if r.Header.Get("Content-Encoding") == "snappy" {
+		body = snappy.NewReader(r.Body)
+	}
+	payload, err := ioutil.ReadAll(body)
+	if err != nil {
+		log.Println(prefix, "cannot read body:", err)
+		http.Error(w, "cannot read body", http.StatusBadRequest)
+		return
+	}
+
+	// Show how the request authenticates, without the secret
+	auth := "none"
+	if header := r.Header.Get("Authorization"); header != "" {
+		auth = strings.SplitN(header, " ", 2)[0]
+	}
+	log.Println(prefix, "content-type:", r.Header.Get("Content-Type"),
+		"encoding:", r.Header.Get("Content-Encoding"), "auth:", auth, "bytes:", len(payload))
+
+	events, err := loopbackEvents(payload)
+	if err != nil {
+		log.Println(prefix, "invalid JSON:", err)
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, event := range events {
+		var pretty bytes.Buffer
+		json.Indent(&pretty, event, "", "  ")
+		log.Printf("%s\n%s", prefix, pretty.String())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(loopbackResponse(r.URL.Path, len(events)))
+}
+
+// A successful response in the shape the mode posting to a path checks,
+// the other modes ignore it
+func loopbackResponse(path string, events int) []byte {
+	switch {
+	case strings.HasSuffix(path, "/_bulk"):
+		return []byte(`{"errors":false,"items":[]}`)
+	case strings.Contains(path, "/services/collector"):
+		return []byte(`{"text":"Success","code":0}`)
+	case strings.Contains(path, "/1/batch/"):
+		statuses := make([]map[string]int, events)
+		for i := range statuses {
+			statuses[i] = map[string]int{"status": http.StatusAccepted}
+		}
+		response, _ := json.Marshal(statuses)
+		return response
+	}
+
+	return []byte(`{}`)
+}
+
+// Split a JSON array, or a stream of JSON values as in NDJSON or the
+// concatenated events of Splunk HEC, into its events
+func loopbackEvents(payload []byte) ([]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+
+	if trimmed[0] == '[' {
+		var events []json.RawMessage
+		err := json.Unmarshal(trimmed, &events)
+		return events, err
+	}
+
+	var events []json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var event json.RawMessage
+		if err := decoder.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("event %d is not JSON: %s", len(events)+1, err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
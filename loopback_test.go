@@ -0,0 +1,22 @@
+package logspoutRancher
+
+import "testing"
+
+func TestLoopbackEvents(t *testing.T) {
+	for name, payload := range map[string]string{
+		"array":        `[{"a":1},{"a":2}]`,
+		"ndjson":       "{\"a\":1}\n{\"a\":2}\n",
+		"concatenated": `{"event":{"a":1}}{"event":{"a":2}}`,
+	} {
+		events, err := loopbackEvents([]byte(payload))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+		} else if len(events) != 2 {
+			t.Errorf("%s: expected 2 events, got %d", name, len(events))
+		}
+	}
+
+	if _, err := loopbackEvents([]byte(`{"a":1}{"a":`)); err == nil {
+		t.Error("expected an error for a truncated event")
+	}
+}
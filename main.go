@@ -1,13 +1,57 @@
 package logspoutRancher
 
 import (
-	"encoding/json"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
 	"github.com/gliderlabs/logspout/router"
 )
 
 func init() {
 	router.AdapterFactories.Register(NewHTTPAdapter, "http")
 	router.AdapterFactories.Register(NewHTTPAdapter, "https")
+	router.AdapterFactories.Register(NewPulsarAdapter, "pulsar")
+	router.AdapterFactories.Register(NewKafkaAdapter, "kafka")
+	router.AdapterFactories.Register(NewNATSAdapter, "nats")
+	router.AdapterFactories.Register(NewRedisAdapter, "redis")
+	router.AdapterFactories.Register(NewAMQPAdapter, "amqp")
+	router.AdapterFactories.Register(NewPubSubAdapter, "pubsub")
+	router.AdapterFactories.Register(NewSQSAdapter, "sqs")
+	router.AdapterFactories.Register(NewSNSAdapter, "sns")
+	router.AdapterFactories.Register(NewFirehoseAdapter, "firehose")
+	router.AdapterFactories.Register(NewCloudWatchAdapter, "cloudwatch")
+	router.AdapterFactories.Register(NewS3Adapter, "s3")
+	router.AdapterFactories.Register(NewEventHubsAdapter, "eventhubs")
+	router.AdapterFactories.Register(NewClickHouseAdapter, "clickhouse")
+	router.AdapterFactories.Register(NewSQLiteAdapter, "sqlite")
+	router.AdapterFactories.Register(NewBigQueryAdapter, "bigquery")
+	router.AdapterFactories.Register(NewBulkAdapter, "elasticsearch")
+	router.AdapterFactories.Register(NewBulkAdapter, "opensearch")
+	router.AdapterFactories.Register(NewQuickwitAdapter, "quickwit")
+	router.AdapterFactories.Register(NewVictoriaLogsAdapter, "victorialogs")
+	router.AdapterFactories.Register(NewLokiAdapter, "loki")
+	router.AdapterFactories.Register(NewSplunkAdapter, "splunk")
+	router.AdapterFactories.Register(NewDatadogAdapter, "datadog")
+	router.AdapterFactories.Register(NewGELFAdapter, "gelf")
+	router.AdapterFactories.Register(NewSumoAdapter, "sumo")
+	router.AdapterFactories.Register(NewNewRelicAdapter, "newrelic")
+	router.AdapterFactories.Register(NewHoneycombAdapter, "honeycomb")
+	router.AdapterFactories.Register(NewAxiomAdapter, "axiom")
+	router.AdapterFactories.Register(NewLogDNAAdapter, "logdna")
+	router.AdapterFactories.Register(NewCoralogixAdapter, "coralogix")
+	router.AdapterFactories.Register(NewPapertrailAdapter, "papertrail")
+	router.AdapterFactories.Register(NewNullAdapter, "null")
+	router.AdapterFactories.Register(NewJSONLinesAdapter, "json")
+	router.AdapterFactories.Register(NewJSONLinesAdapter, "tcp")
+	router.AdapterFactories.Register(NewJSONLinesAdapter, "udp")
+	router.AdapterFactories.Register(NewSyslogAdapter, "syslog")
+	router.AdapterFactories.Register(NewWebSocketAdapter, "ws")
+	router.AdapterFactories.Register(NewWebSocketAdapter, "wss")
+	router.AdapterFactories.Register(NewGRPCAdapter, "grpc")
+	router.AdapterFactories.Register(NewOTLPAdapter, "otlp")
+	router.AdapterFactories.Register(NewJournaldAdapter, "journald")
+	router.HTTPHandlers.Register(NewLiveTailHandler, "tail")
+	router.HTTPHandlers.Register(NewRecentHandler, "recent")
 }
 
 // Stream implements the router.LogAdapter interface
@@ -16,52 +60,161 @@ func (a *HTTPAdapter) Stream(logstream chan *router.Message) {
 		select {
 		case message := <-logstream:
 
-			dockerInfo := DockerInfo{
-				Name:     message.Container.Name,
-				ID:       message.Container.ID,
-				Image:    message.Container.Config.Image,
-				Hostname: message.Container.Config.Hostname,
+			// In tail mode the backlog logspout replays on start is not shipped
+			if a.tailOnly && message.Time.Before(a.started) {
+				continue
 			}
 
-			fields := GetLogstashFields(message.Container, a)
+			a.handleMessage(message)
+		case message := <-a.backfill:
 
-			rancherInfo := GetRancherInfo(message.Container)
+			// Past line requested by the adapter itself
+			a.handleMessage(message)
+		case data := <-a.queue:
 
-			if rancherInfo == nil {
-				continue
-			}
+			// Event generated by the adapter itself, already enriched
+			a.enqueue(data)
+		case reason := <-a.flushes:
 
-			var data map[string]interface{}
-			var err error
+			// Flush requested by the adapter itself
+			a.flushHttp(reason)
+		case <-a.timer.C:
 
-			// Try to parse JSON-encoded m.Data. If it wasn't JSON, create an empty object
-			// and use the original data as the message.
-			if err = json.Unmarshal([]byte(message.Data), &data); err != nil {
-				data = make(map[string]interface{})
-				data["message"] = message.Data
-			}
+			// Timeout, flush
+			a.flushHttp("timeout")
+		}
+	}
+}
 
-			for k, v := range fields {
-				data[k] = v
-			}
+// Turn a log message into an enriched event and buffer it
+func (a *HTTPAdapter) handleMessage(message *router.Message) {
+	// Lines of containers with a TTY carry terminal control characters
+	if message.Container.Config.Tty {
+		message.Data = cleanTTYLine(message.Data)
+	}
+
+	if !a.quota.allow(message.Container, len(message.Data)) {
+		return
+	}
 
-			data["docker"] = dockerInfo
-			data["rancher"] = rancherInfo
+	data := a.parser.parse(message.Data)
 
-			// Append the message to the buffer
-			a.bufferMutex.Lock()
-			a.buffer = append(a.buffer, &data)
-			a.bufferMutex.Unlock()
+	// Keep the time of the line unless the application logged its own
+	if _, ok := data["@timestamp"]; !ok && !message.Time.IsZero() {
+		data["@timestamp"] = message.Time
+	}
 
-			// Flush if the buffer is at capacity
-			if len(a.buffer) >= cap(a.buffer) {
-				a.flushHttp("full")
-			}
-		case <-a.timer.C:
+	if !a.enrich(data, message.Container) {
+		a.audit.record(message.Container.Name, message.Container.ID, dropFiltered, 1)
+		a.metrics.count("dropped", 1, "reason", dropFiltered)
+		return
+	}
 
-			// Timeout, flush
-			a.flushHttp("timeout")
+	if a.metrics.enabled() {
+		meta := newTemplateData(data)
+		level := lineLevel(data, a.levelKey, a.parser.messageKey)
+		if level == "" {
+			level = "none"
 		}
+		a.metrics.count("lines", 1, "stack", meta.Stack, "service", meta.Service, "level", level)
+		a.metrics.count("bytes", int64(len(message.Data)), "stack", meta.Stack, "service", meta.Service)
 	}
+
+	a.enqueue(&data)
 }
 
+// Add the logstash fields, docker, rancher, swarm, kubernetes and compose
+// metadata of the container to the event, returns false when the container
+// is excluded or there is no orchestrator metadata for it
+func (a *HTTPAdapter) enrich(data map[string]interface{}, container *docker.Container) bool {
+	if a.filter.excluded(container) {
+		return false
+	}
+	a.activity.touch(container.ID)
+
+	dockerInfo := DockerInfo{
+		Name:     container.Name,
+		ID:       container.ID,
+		Image:    container.Config.Image,
+		Hostname: container.Config.Hostname,
+	}
+
+	fields := GetLogstashFields(container, a)
+
+	rancherInfo := a.rancher.GetRancherInfo(container)
+	if a.faults.rancherFails() {
+		rancherInfo = nil
+	}
+
+	swarmInfo := GetSwarmInfo(container)
+
+	kubernetesInfo := GetKubernetesInfo(container)
+
+	composeInfo := GetComposeInfo(container)
+
+	if rancherInfo == nil && swarmInfo == nil && kubernetesInfo == nil && composeInfo == nil {
+		return false
+	}
+
+	for k, v := range fields {
+		a.parser.set(data, k, v)
+	}
+
+	a.parser.set(data, "docker", dockerInfo)
+	if rancherInfo != nil {
+		a.parser.set(data, "rancher", rancherInfo)
+	}
+	if swarmInfo != nil {
+		a.parser.set(data, "swarm", swarmInfo)
+	}
+	if kubernetesInfo != nil {
+		a.parser.set(data, "kubernetes", kubernetesInfo)
+	}
+	if composeInfo != nil {
+		a.parser.set(data, "compose", composeInfo)
+	}
+
+	return true
+}
+
+// Append an event to the buffer and flush if the buffer is at capacity
+func (a *HTTPAdapter) enqueue(data *map[string]interface{}) {
+	// Every event is anonymised, the lines and those of the adapter itself,
+	// once in the layout of the route so the paths are those shipped
+	a.applySchema(*data)
+	a.hasher.apply(*data)
+	a.sentry.forward(*data)
+	a.pagerduty.observe(*data)
+	a.slack.observe(*data)
+	if a.liveTail {
+		liveTail.publish(*data)
+	}
+	if a.liveTailRemote != nil {
+		a.forwardLiveTail(*data)
+	}
+	if a.recentSize > 0 {
+		recent.add(*data, a.recentSize)
+	}
+
+	if _, ok := (*data)["@timestamp"]; !ok {
+		(*data)["@timestamp"] = time.Now()
+	}
+	if a.instance != "" {
+		a.stampDelivery(*data)
+	}
+
+	size := eventSize(*data)
+	if !a.reserveMemory(data, size) {
+		return
+	}
+
+	a.bufferMutex.Lock()
+	a.buffer = append(a.buffer, data)
+	a.bufferBytes += size
+	a.spool.append(data)
+	a.bufferMutex.Unlock()
+
+	if len(a.buffer) >= cap(a.buffer) {
+		a.flushHttp("full")
+	}
+}
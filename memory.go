@@ -0,0 +1,159 @@
+package logspoutRancher
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Policies applied when the memory budget of a route is exhausted
+const (
+	memoryDropNewest = "drop-newest"
+	memoryDropOldest = "drop-oldest"
+	memoryBlock      = "block"
+)
+
+// Rough overhead of an event besides its keys and strings
+const eventOverhead = 256
+
+// memoryBudget bounds the bytes of the events a route holds in memory, the
+// buffered ones and those of the batches being delivered
+type memoryBudget struct {
+	limit    int64
+	policy   string
+	used     int64
+	dropped  int64
+	reported time.Time
+	mutex    sync.Mutex
+	released *sync.Cond
+}
+
+// Create the budget from the http.memory.* options, nil without a limit
+func newMemoryBudget(options map[string]string) *memoryBudget {
+	limit := getIntParameter(options, "http.memory.limit", 0)
+	if limit <= 0 {
+		return nil
+	}
+
+	policy := getStringParameter(options, "http.memory.policy", memoryDropNewest)
+	if policy != memoryDropNewest && policy != memoryDropOldest && policy != memoryBlock {
+		debug("http: invalid value for parameter: http.memory.policy", policy,
+			"using default:", memoryDropNewest)
+		policy = memoryDropNewest
+	}
+
+	m := &memoryBudget{limit: int64(limit), policy: policy}
+	m.released = sync.NewCond(&m.mutex)
+	debug("http: memory limit:", limit, "policy:", policy)
+
+	return m
+}
+
+// Estimate the bytes an event holds, its keys and strings plus an overhead
+// for the rest
+func eventSize(data map[string]interface{}) int64 {
+	size := int64(eventOverhead)
+	for k, v := range data {
+		size += int64(len(k))
+		if s, ok := v.(string); ok {
+			size += int64(len(s))
+		} else {
+			size += 16
+		}
+	}
+
+	return size
+}
+
+// An event always fits an empty budget, however large it is
+func (m *memoryBudget) fits(size int64) bool {
+	return m.used == 0 || m.used+size <= m.limit
+}
+
+// Account for events kept in memory past the delivery of their batch,
+// whatever the policy; a nil budget does nothing
+func (m *memoryBudget) hold(size int64) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	m.used += size
+	m.mutex.Unlock()
+}
+
+// Give back the bytes of a delivered or dropped batch, a nil budget does
+// nothing
+func (m *memoryBudget) release(size int64) {
+	if m == nil || size == 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	m.used -= size
+	m.mutex.Unlock()
+	m.released.Broadcast()
+}
+
+// Make room for an event according to the policy, false when the event is
+// dropped; called from the stream loop only
+func (a *HTTPAdapter) reserveMemory(data *map[string]interface{}, size int64) bool {
+	m := a.memory
+	if m == nil {
+		return true
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for !m.fits(size) {
+		switch {
+		case m.policy == memoryDropOldest && len(a.buffer) > 0:
+			a.bufferMutex.Lock()
+			oldest := a.buffer[0]
+			a.buffer = a.buffer[1:]
+			evicted := eventSize(*oldest)
+			a.bufferBytes -= evicted
+			a.bufferMutex.Unlock()
+			m.used -= evicted
+			a.dropMemory(oldest)
+		case m.policy == memoryBlock && a.holding():
+			// The buffered events cannot be released until they are flushed
+			m.mutex.Unlock()
+			a.flushHttp("memory")
+			m.mutex.Lock()
+		case m.policy == memoryBlock:
+			m.released.Wait()
+		default:
+			a.dropMemory(data)
+			return false
+		}
+	}
+	m.used += size
+
+	return true
+}
+
+// Whether events wait in the buffer or the requeued batches
+func (a *HTTPAdapter) holding() bool {
+	a.bufferMutex.Lock()
+	defer a.bufferMutex.Unlock()
+
+	return len(a.buffer) > 0 || len(a.requeued) > 0
+}
+
+// Account for an event dropped for lack of memory, the drops are logged at
+// most once a minute; the caller holds the budget mutex
+func (a *HTTPAdapter) dropMemory(data *map[string]interface{}) {
+	a.audit.recordBatch([]*map[string]interface{}{data}, dropMemory)
+	a.metrics.count("dropped", 1, "reason", dropMemory)
+
+	m := a.memory
+	m.dropped++
+	if time.Since(m.reported) >= time.Minute {
+		log.Println("http: route:", a.route.ID, "memory limit of", m.limit, "bytes reached, dropped:", m.dropped,
+			"policy:", m.policy)
+		m.reported = time.Now()
+		m.dropped = 0
+	}
+}
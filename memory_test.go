@@ -0,0 +1,87 @@
+package logspoutRancher
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+func TestMemoryBudgetOptions(t *testing.T) {
+	if newMemoryBudget(map[string]string{}) != nil {
+		t.Error("expected no budget without a limit")
+	}
+
+	for policy, expected := range map[string]string{
+		"":               memoryDropNewest,
+		memoryDropOldest: memoryDropOldest,
+		memoryBlock:      memoryBlock,
+		"drop-random":    memoryDropNewest,
+	} {
+		options := map[string]string{"http.memory.limit": "1024"}
+		if policy != "" {
+			options["http.memory.policy"] = policy
+		}
+		if m := newMemoryBudget(options); m.policy != expected {
+			t.Errorf("%q: expected %s, got %s", policy, expected, m.policy)
+		}
+	}
+}
+
+func TestMemoryBudgetAccounting(t *testing.T) {
+	var m *memoryBudget
+	m.hold(100)
+	m.release(100)
+
+	m = newMemoryBudget(map[string]string{"http.memory.limit": "1000"})
+	if !m.fits(5000) {
+		t.Error("expected any event to fit an empty budget")
+	}
+	m.hold(600)
+	if m.fits(500) || !m.fits(400) {
+		t.Errorf("expected 400 bytes to fit and 500 not with %d used", m.used)
+	}
+	m.release(600)
+	if m.used != 0 {
+		t.Errorf("expected an empty budget, got %d used", m.used)
+	}
+}
+
+func TestReserveMemory(t *testing.T) {
+	event := func(message string) *map[string]interface{} {
+		return &map[string]interface{}{"message": message}
+	}
+	size := eventSize(*event("a"))
+
+	for policy, expected := range map[string][]string{
+		memoryDropNewest: {"a", "b"},
+		memoryDropOldest: {"b", "c"},
+	} {
+		a := &HTTPAdapter{
+			route: &router.Route{ID: "test"},
+			memory: newMemoryBudget(map[string]string{
+				"http.memory.limit":  strconv.FormatInt(2*size, 10),
+				"http.memory.policy": policy,
+			}),
+		}
+
+		for _, message := range []string{"a", "b", "c"} {
+			data := event(message)
+			if a.reserveMemory(data, size) {
+				a.buffer = append(a.buffer, data)
+				a.bufferBytes += size
+			}
+		}
+
+		var buffered []string
+		for _, data := range a.buffer {
+			buffered = append(buffered, (*data)["message"].(string))
+		}
+		if len(buffered) != len(expected) || buffered[0] != expected[0] || buffered[1] != expected[1] {
+			t.Errorf("%s: expected %v buffered, got %v", policy, expected, buffered)
+		}
+		if a.memory.used != 2*size {
+			t.Errorf("%s: expected %d bytes used, got %d", policy, 2*size, a.memory.used)
+		}
+	}
+}
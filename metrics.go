@@ -0,0 +1,29 @@
+package logspoutRancher
+
+// metricSink receives the log counters of an adapter, the tags are name
+// and value pairs
+type metricSink interface {
+	count(name string, n int64, tags ...string)
+}
+
+// logMetrics fans the counters of a route out to its metric sinks, tagged
+// with the route ID so routes sharing a sink stay apart
+type logMetrics struct {
+	route string
+	sinks []metricSink
+}
+
+func (m *logMetrics) enabled() bool {
+	return m != nil && len(m.sinks) > 0
+}
+
+func (m *logMetrics) count(name string, n int64, tags ...string) {
+	if !m.enabled() {
+		return
+	}
+
+	tags = append([]string{"route", m.route}, tags...)
+	for _, sink := range m.sinks {
+		sink.count(name, n, tags...)
+	}
+}
@@ -0,0 +1,118 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/nats-io/nats.go"
+)
+
+// Characters not allowed in NATS subjects, apart from the token separator
+var invalidSubjectChars = regexp.MustCompile(`[\s*>]+`)
+
+// natsSink publishes events to a subject per stack and service, through
+// JetStream with publish acks when enabled
+type natsSink struct {
+	conn       *nats.Conn
+	jetstream  nats.JetStreamContext
+	subject    *template.Template
+	ackTimeout time.Duration
+}
+
+// NewNATSAdapter creates an adapter publishing to nats://nats:4222, several
+// servers are separated by commas
+func NewNATSAdapter(route *router.Route) (router.LogAdapter, error) {
+	// nats+tls://nats:4222 connects over TLS
+	scheme := "nats"
+	if route.AdapterTransport("") == "tls" {
+		scheme = "tls"
+	}
+	var servers []string
+	for _, server := range strings.Split(route.Address, ",") {
+		servers = append(servers, scheme+"://"+server)
+	}
+
+	options := []nats.Option{nats.Name("logspout-rancher"), nats.MaxReconnects(-1)}
+	if token := secretParameter(route.Options, "nats.token", "NATS_TOKEN"); token != "" {
+		options = append(options, nats.Token(token))
+	}
+	if creds := getStringParameter(route.Options, "nats.creds", ""); creds != "" {
+		options = append(options, nats.UserCredentials(creds))
+	}
+
+	conn, err := nats.Connect(strings.Join(servers, ","), options...)
+	if err != nil {
+		return nil, fmt.Errorf("nats: cannot connect: %s", err)
+	}
+	debug("nats: servers:", conn.Servers())
+
+	s := &natsSink{
+		conn:       conn,
+		subject:    parseTemplate("nats.subject", getStringParameter(route.Options, "nats.subject", "logs.{{.Stack}}.{{.Service}}")),
+		ackTimeout: getDurationParameter(route.Options, "nats.jetstream.timeout", 10*time.Second),
+	}
+
+	// Publish acks guarantee the events are stored by the stream
+	if getStringParameter(route.Options, "nats.jetstream", "false") == "true" {
+		s.jetstream, err = conn.JetStream()
+		if err != nil {
+			return nil, fmt.Errorf("nats: cannot create JetStream context: %s", err)
+		}
+		debug("nats: publishing through JetStream")
+	}
+
+	adapter := newAdapter(route)
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Publish the batch, waiting for the publish acks with JetStream and for
+// the server to process it otherwise
+func (s *natsSink) send(buffer []*map[string]interface{}) error {
+	var acks []nats.PubAckFuture
+
+	for _, data := range buffer {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+		subject := invalidSubjectChars.ReplaceAllString(renderTemplate(s.subject, *data), "_")
+
+		if s.jetstream != nil {
+			ack, err := s.jetstream.PublishAsync(subject, payload)
+			if err != nil {
+				return fmt.Errorf("error on publish: %s", err)
+			}
+			acks = append(acks, ack)
+		} else if err := s.conn.Publish(subject, payload); err != nil {
+			return fmt.Errorf("error on publish: %s", err)
+		}
+	}
+
+	if s.jetstream == nil {
+		if err := s.conn.FlushTimeout(s.ackTimeout); err != nil {
+			return fmt.Errorf("error on flush: %s", err)
+		}
+		return nil
+	}
+
+	timeout := time.After(s.ackTimeout)
+	for _, ack := range acks {
+		select {
+		case <-ack.Ok():
+		case err := <-ack.Err():
+			return fmt.Errorf("publish not acknowledged: %s", err)
+		case <-timeout:
+			return fmt.Errorf("publish acks not received within %s", s.ackTimeout)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// The Log API rejects payloads over 1MB
+const newRelicMaxPayloadBytes = 1000 * 1000
+
+// newRelicFormat posts events to the New Relic Log API in its detailed
+// JSON envelope
+type newRelicFormat struct {
+	url        string
+	header     http.Header
+	messageKey string
+	drop       func(data *map[string]interface{}, reason string)
+}
+
+// A log of the detailed envelope
+type newRelicLog struct {
+	Timestamp  int64                  `json:"timestamp"`
+	Message    interface{}            `json:"message,omitempty"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// NewNewRelicAdapter creates an adapter sending to the Log API, e.g.
+// newrelic://log-api.newrelic.com or newrelic://log-api.eu.newrelic.com
+func NewNewRelicAdapter(route *router.Route) (router.LogAdapter, error) {
+	licenseKey := secretParameter(route.Options, "newrelic.license_key", "NEW_RELIC_LICENSE_KEY")
+	if licenseKey == "" {
+		return nil, fmt.Errorf("newrelic: newrelic.license_key is required")
+	}
+
+	adapter := newHTTPAdapter(route)
+	format := &newRelicFormat{
+		url:        adapter.url + "/log/v1",
+		header:     http.Header{},
+		messageKey: adapter.parser.messageKey,
+		drop:       adapter.dropEvent,
+	}
+	format.header.Set("X-License-Key", licenseKey)
+	debug("newrelic: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as envelopes of at most 1MB, the Rancher metadata and
+// the other fields of an event being attributes of its log; a log larger
+// than 1MB on its own is dropped
+func (f *newRelicFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	var payloads []*httpPayload
+	var logs []json.RawMessage
+	size := 0
+
+	closeEnvelope := func() error {
+		body, err := json.Marshal([]map[string]interface{}{{"logs": logs}})
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+		payloads = append(payloads, &httpPayload{
+			url:         f.url,
+			contentType: "application/json",
+			header:      f.header,
+			body:        body,
+		})
+		logs, size = nil, 0
+		return nil
+	}
+
+	for _, data := range buffer {
+		timestamp := time.Now()
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			timestamp = t
+		}
+		meta := newTemplateData(*data)
+
+		attributes := make(map[string]interface{}, len(*data)+5)
+		for k, v := range *data {
+			if k != f.messageKey && k != "@timestamp" {
+				attributes[k] = v
+			}
+		}
+		attributes["stack"] = meta.Stack
+		attributes["service"] = meta.Service
+		attributes["container"] = meta.Container
+		attributes["hostname"] = meta.Hostname
+		attributes["logtype"] = "rancher"
+
+		entry, err := json.Marshal(newRelicLog{
+			Timestamp:  timestamp.UnixNano() / int64(time.Millisecond),
+			Message:    (*data)[f.messageKey],
+			Attributes: attributes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		// Room for the envelope and the separators
+		if len(entry)+32 > newRelicMaxPayloadBytes {
+			f.drop(data, dropOversized)
+			continue
+		}
+		if len(logs) > 0 && size+len(entry)+32 > newRelicMaxPayloadBytes {
+			if err := closeEnvelope(); err != nil {
+				return nil, err
+			}
+		}
+		logs = append(logs, entry)
+		size += len(entry) + 1
+	}
+
+	if len(logs) > 0 {
+		if err := closeEnvelope(); err != nil {
+			return nil, err
+		}
+	}
+
+	return payloads, nil
+}
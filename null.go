@@ -0,0 +1,57 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// nullSink serializes the batches like a real sink but discards them,
+// logging the throughput to measure the overhead of the pipeline
+type nullSink struct {
+	events  int64
+	bytes   int64
+	batches int64
+}
+
+// NewNullAdapter creates an adapter discarding the events, e.g. null://
+func NewNullAdapter(route *router.Route) (router.LogAdapter, error) {
+	s := &nullSink{}
+	go s.report(getDurationParameter(route.Options, "null.interval", 10*time.Second))
+
+	adapter := newAdapter(route)
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+func (s *nullSink) send(buffer []*map[string]interface{}) error {
+	payload, err := json.Marshal(buffer)
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	atomic.AddInt64(&s.events, int64(len(buffer)))
+	atomic.AddInt64(&s.bytes, int64(len(payload)))
+	atomic.AddInt64(&s.batches, 1)
+
+	return nil
+}
+
+// Log the throughput of every interval
+func (s *nullSink) report(interval time.Duration) {
+	for range time.Tick(interval) {
+		events := atomic.SwapInt64(&s.events, 0)
+		bytes := atomic.SwapInt64(&s.bytes, 0)
+		batches := atomic.SwapInt64(&s.batches, 0)
+
+		log.Printf("null: %d events (%.1f/s), %d bytes (%.1f KB/s), %d batches in %s",
+			events, float64(events)/interval.Seconds(),
+			bytes, float64(bytes)/1024/interval.Seconds(), batches, interval)
+	}
+}
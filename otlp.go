@@ -0,0 +1,186 @@
+package logspoutRancher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	logs "go.opentelemetry.io/proto/otlp/logs/v1"
+	resource "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Severity numbers of OTLP log records, by lowercased level
+var otlpSeverities = map[string]logs.SeverityNumber{
+	"trace":    logs.SeverityNumber_SEVERITY_NUMBER_TRACE,
+	"debug":    logs.SeverityNumber_SEVERITY_NUMBER_DEBUG,
+	"info":     logs.SeverityNumber_SEVERITY_NUMBER_INFO,
+	"notice":   logs.SeverityNumber_SEVERITY_NUMBER_INFO2,
+	"warn":     logs.SeverityNumber_SEVERITY_NUMBER_WARN,
+	"warning":  logs.SeverityNumber_SEVERITY_NUMBER_WARN,
+	"error":    logs.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	"err":      logs.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	"critical": logs.SeverityNumber_SEVERITY_NUMBER_FATAL,
+	"fatal":    logs.SeverityNumber_SEVERITY_NUMBER_FATAL,
+	"panic":    logs.SeverityNumber_SEVERITY_NUMBER_FATAL4,
+}
+
+// otlpSink exports events as OTLP log records to an OpenTelemetry
+// collector, with the Rancher metadata of their container as resource
+type otlpSink struct {
+	client     collogs.LogsServiceClient
+	metadata   metadata.MD
+	timeout    time.Duration
+	messageKey string
+	levelKey   string
+	dropCount  func(count int64, reason string)
+}
+
+// NewOTLPAdapter creates an adapter exporting to otlp://collector:4317, or
+// otlp+tls://collector:4317
+func NewOTLPAdapter(route *router.Route) (router.LogAdapter, error) {
+	creds, err := grpcCredentials(route, "otlp")
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(route.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("otlp: cannot dial %s: %s", route.Address, err)
+	}
+
+	// Headers of the exports, e.g. otlp.header.api-key=...
+	md := metadata.MD{}
+	for option, value := range route.Options {
+		if strings.HasPrefix(option, "otlp.header.") {
+			md.Set(strings.TrimPrefix(option, "otlp.header."), value)
+		}
+	}
+
+	adapter := newAdapter(route)
+	adapter.sink = &otlpSink{
+		client:     collogs.NewLogsServiceClient(conn),
+		metadata:   md,
+		timeout:    getDurationParameter(route.Options, "otlp.timeout", 10*time.Second),
+		messageKey: adapter.parser.messageKey,
+		levelKey:   getStringParameter(route.Options, "otlp.level_key", "level"),
+		dropCount:  adapter.dropCount,
+	}
+	debug("otlp:", route.Address)
+	adapter.start()
+
+	return adapter, nil
+}
+
+func otlpString(key string, value string) *common.KeyValue {
+	return &common.KeyValue{Key: key, Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: value}}}
+}
+
+// Value of an event field, nested ones are JSON encoded
+func otlpValue(value interface{}) *common.AnyValue {
+	switch v := value.(type) {
+	case string:
+		return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &common.AnyValue{Value: &common.AnyValue_BoolValue{BoolValue: v}}
+	case float64:
+		return &common.AnyValue{Value: &common.AnyValue_DoubleValue{DoubleValue: v}}
+	}
+
+	encoded, _ := json.Marshal(value)
+	return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: string(encoded)}}
+}
+
+// Convert the batch to log records grouped by container, the message is the
+// body of a record and the other fields of the event its attributes
+func (s *otlpSink) encode(buffer []*map[string]interface{}) (*collogs.ExportLogsServiceRequest, error) {
+	request := &collogs.ExportLogsServiceRequest{}
+	scopes := make(map[string]*logs.ScopeLogs)
+	now := uint64(time.Now().UnixNano())
+
+	for _, data := range buffer {
+		generic, err := genericEvent(data)
+		if err != nil {
+			return nil, err
+		}
+		meta := newTemplateData(*data)
+
+		key := meta.ContainerID + "/" + meta.Stack + "/" + meta.Service
+		scope, ok := scopes[key]
+		if !ok {
+			scope = &logs.ScopeLogs{Scope: &common.InstrumentationScope{Name: "logspout-rancher"}}
+			scopes[key] = scope
+			request.ResourceLogs = append(request.ResourceLogs, &logs.ResourceLogs{
+				Resource: &resource.Resource{Attributes: []*common.KeyValue{
+					otlpString("service.name", meta.Service),
+					otlpString("service.namespace", meta.Stack),
+					otlpString("rancher.stack.name", meta.Stack),
+					otlpString("rancher.service.name", meta.Service),
+					otlpString("container.name", meta.Container),
+					otlpString("container.id", meta.ContainerID),
+					otlpString("container.image.name", meta.Image),
+					otlpString("host.name", meta.Hostname),
+				}},
+				ScopeLogs: []*logs.ScopeLogs{scope},
+			})
+		}
+
+		record := &logs.LogRecord{ObservedTimeUnixNano: now}
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			record.TimeUnixNano = uint64(t.UnixNano())
+		}
+		level := lineLevel(*data, s.levelKey, s.messageKey)
+		if severity, ok := otlpSeverities[level]; ok {
+			record.SeverityNumber = severity
+			record.SeverityText = strings.ToUpper(level)
+		}
+
+		if message, ok := generic[s.messageKey]; ok {
+			record.Body = otlpValue(message)
+		} else {
+			event, _ := json.Marshal(generic)
+			record.Body = otlpValue(string(event))
+		}
+		for _, field := range []string{s.messageKey, "@timestamp", "docker", "rancher"} {
+			delete(generic, field)
+		}
+		for field, value := range generic {
+			if value != nil {
+				record.Attributes = append(record.Attributes, &common.KeyValue{Key: field, Value: otlpValue(value)})
+			}
+		}
+
+		scope.LogRecords = append(scope.LogRecords, record)
+	}
+
+	return request, nil
+}
+
+// Export the batch, records the collector rejects are dropped; it only
+// tells how many, so they are audited without their container
+func (s *otlpSink) send(buffer []*map[string]interface{}) error {
+	request, err := s.encode(buffer)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), s.metadata), s.timeout)
+	defer cancel()
+
+	response, err := s.client.Export(ctx, request)
+	if err != nil {
+		return fmt.Errorf("error on Export: %s", err)
+	}
+	if partial := response.GetPartialSuccess(); partial.GetRejectedLogRecords() > 0 {
+		debug("otlp: dropping", partial.GetRejectedLogRecords(), "rejected records:", partial.GetErrorMessage())
+		s.dropCount(partial.GetRejectedLogRecords(), dropRejected)
+	}
+
+	return nil
+}
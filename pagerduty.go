@@ -0,0 +1,157 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Endpoint of the PagerDuty Events API v2
+const pagerDutyEventsUrl = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyAlerter triggers a PagerDuty alert when a pattern is seen more
+// than a number of times within a window for a service
+type pagerDutyAlerter struct {
+	routingKey string
+	patterns   []*regexp.Regexp
+	count      int
+	window     time.Duration
+	messageKey string
+	metrics    *logMetrics
+	client     *http.Client
+	hits       map[string][]time.Time
+	alerts     chan map[string]interface{}
+}
+
+// Create an alerter from the http.pagerduty.* options of a route, the
+// patterns are regular expressions separated by ;
+func newPagerDutyAlerter(routingKey string, options map[string]string, messageKey string) (*pagerDutyAlerter, error) {
+	p := &pagerDutyAlerter{
+		routingKey: routingKey,
+		count:      getIntParameter(options, "http.pagerduty.count", 0),
+		window:     getDurationParameter(options, "http.pagerduty.window", 5*time.Minute),
+		messageKey: messageKey,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		hits:       make(map[string][]time.Time),
+		alerts:     make(chan map[string]interface{}, 100),
+	}
+
+	for _, pattern := range strings.Split(getStringParameter(options, "http.pagerduty.patterns", ""), ";") {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	if len(p.patterns) == 0 {
+		return nil, fmt.Errorf("http.pagerduty.patterns is required")
+	}
+
+	return p, nil
+}
+
+// Count the patterns the message of an event matches, and trigger an alert
+// for those seen more than count times within the window. Only called from
+// the Stream goroutine
+func (p *pagerDutyAlerter) observe(data map[string]interface{}) {
+	if p == nil {
+		return
+	}
+
+	message, ok := data[p.messageKey].(string)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	for _, pattern := range p.patterns {
+		if !pattern.MatchString(message) {
+			continue
+		}
+
+		meta := newTemplateData(data)
+		key := meta.Stack + "/" + meta.Service + ":" + pattern.String()
+		p.metrics.count("pagerduty_matches", 1, "stack", meta.Stack, "service", meta.Service, "pattern", pattern.String())
+
+		// Keep the hits within the window
+		hits := append(p.hits[key], now)
+		for len(hits) > 0 && now.Sub(hits[0]) > p.window {
+			hits = hits[1:]
+		}
+		p.hits[key] = hits
+
+		if len(hits) > p.count {
+			p.trigger(key, pattern.String(), len(hits), message, meta)
+			delete(p.hits, key)
+		}
+	}
+}
+
+// Queue a trigger event, deduplicated by service and pattern
+func (p *pagerDutyAlerter) trigger(key string, pattern string, hits int, message string, meta *templateData) {
+	alert := map[string]interface{}{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    key,
+		"payload": map[string]interface{}{
+			"summary":   fmt.Sprintf("%s/%s: %q seen %d times in %s", meta.Stack, meta.Service, pattern, hits, p.window),
+			"source":    meta.Hostname,
+			"severity":  "error",
+			"component": meta.Service,
+			"group":     meta.Stack,
+			"custom_details": map[string]interface{}{
+				"pattern":   pattern,
+				"count":     hits,
+				"window":    p.window.String(),
+				"container": meta.Container,
+				"image":     meta.Image,
+				"message":   message,
+			},
+		},
+	}
+
+	select {
+	case p.alerts <- alert:
+	default:
+		debug("http: pagerduty: dropping alert, queue full:", key)
+	}
+}
+
+// Send the queued alerts to PagerDuty
+func (p *pagerDutyAlerter) run() {
+	for alert := range p.alerts {
+		if err := p.send(alert); err != nil {
+			debug("http: pagerduty:", err)
+		}
+	}
+}
+
+func (p *pagerDutyAlerter) send(alert map[string]interface{}) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	response, err := p.client.Post(pagerDutyEventsUrl, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error on client.Post: %s", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 202 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("response not 202 but %d: %s", response.StatusCode, body)
+	}
+	io.Copy(ioutil.Discard, response.Body)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// papertrailFormat posts events to the HTTPS log destination of
+// Papertrail, one JSON event per line
+type papertrailFormat struct {
+	url      string
+	header   http.Header
+	hostname *template.Template
+	program  *template.Template
+}
+
+// NewPapertrailAdapter creates an adapter sending to Papertrail, e.g.
+// papertrail://logs.collector.solarwinds.com
+func NewPapertrailAdapter(route *router.Route) (router.LogAdapter, error) {
+	token := getStringParameter(route.Options, "papertrail.token", "")
+	if token == "" {
+		return nil, fmt.Errorf("papertrail: papertrail.token is required")
+	}
+
+	adapter := newHTTPAdapter(route)
+	format := &papertrailFormat{
+		url:    adapter.url + "/v1/logs",
+		header: http.Header{},
+		hostname: parseTemplate("papertrail.hostname", getStringParameter(route.Options,
+			"papertrail.hostname", "{{.Hostname}}")),
+		program: parseTemplate("papertrail.program", getStringParameter(route.Options,
+			"papertrail.program", "{{.Stack}}/{{.Service}}")),
+	}
+
+	// The token is the password of basic authentication
+	request := &http.Request{Header: http.Header{}}
+	request.SetBasicAuth("", token)
+	format.header.Set("Authorization", request.Header.Get("Authorization"))
+	debug("papertrail: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as lines, each event carries the hostname and program
+// Papertrail groups events by
+func (f *papertrailFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	var body bytes.Buffer
+
+	for _, data := range buffer {
+		row := make(map[string]interface{}, len(*data)+2)
+		for k, v := range *data {
+			row[k] = v
+		}
+		row["hostname"] = renderTemplate(f.hostname, *data)
+		row["program"] = renderTemplate(f.program, *data)
+
+		event, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		body.Write(event)
+		body.WriteByte('\n')
+	}
+
+	return []*httpPayload{{
+		url:         f.url,
+		contentType: "application/octet-stream",
+		header:      f.header,
+		body:        body.Bytes(),
+	}}, nil
+}
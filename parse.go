@@ -0,0 +1,310 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// Characters Elasticsearch rejects or that break index templates in keys
+var invalidKeyChars = regexp.MustCompile(`[^\w@-]`)
+
+// Levels of plain text lines, e.g. "2017-06-01 ERROR cannot connect"
+var levelPattern = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|FATAL|CRITICAL|PANIC)\b`)
+
+// messageParser turns a log line into the fields of an event
+type messageParser struct {
+	messageKey  string
+	rawKey      string
+	errorDetail bool
+	maxDepth    int
+	maxKeys     int
+	maxBytes    int
+	prefix      string
+	nest        string
+	sanitize    bool
+	keyCase     string
+	collision   string
+	conflictKey string
+	collisions  int64
+	metrics     *logMetrics
+}
+
+func newMessageParser(options map[string]string) *messageParser {
+	p := &messageParser{
+		messageKey: getStringParameter(options, "http.message_key", "message"),
+	}
+
+	// Keep the original line of JSON messages, parsing is lossy
+	if getStringParameter(options, "http.raw", "false") == "true" {
+		p.rawKey = getStringParameter(options, "http.raw_key", "raw")
+	}
+
+	// Add the parse error to the events flagged with json_parse_error
+	p.errorDetail = getStringParameter(options, "http.json.error_detail", "false") == "true"
+
+	// Limits protecting the mappings and our memory from huge objects
+	p.maxDepth = getIntParameter(options, "http.json.maxdepth", 0)
+	p.maxKeys = getIntParameter(options, "http.json.maxkeys", 0)
+	p.maxBytes = getIntParameter(options, "http.json.maxbytes", 0)
+
+	// Make the keys of parsed messages acceptable to Elasticsearch
+	p.sanitize = getStringParameter(options, "http.keys.sanitize", "false") == "true"
+
+	// Normalize the case of the keys of parsed messages and static fields
+	p.keyCase = getStringParameter(options, "http.keys.case", "")
+	if p.keyCase != "" && p.keyCase != "lower" && p.keyCase != "snake" {
+		debug("http: invalid value for parameter: http.keys.case", p.keyCase)
+		p.keyCase = ""
+	}
+
+	// Keep the application fields apart from the ones we add
+	p.prefix = getStringParameter(options, "http.parsed_prefix", "")
+	p.nest = getStringParameter(options, "http.parsed_nest", "")
+
+	// What happens to application fields named like the ones we add
+	p.collision = getStringParameter(options, "http.collision", "overwrite")
+	switch p.collision {
+	case "overwrite", "rename", "drop":
+	case "nest":
+		p.conflictKey = getStringParameter(options, "http.collision.key", "conflicts")
+	default:
+		debug("http: invalid value for parameter: http.collision", p.collision,
+			"using default: overwrite")
+		p.collision = "overwrite"
+	}
+
+	return p
+}
+
+// Parse a log line, JSON objects become the event fields and any other
+// line is stored under the message key
+func (p *messageParser) parse(line string) map[string]interface{} {
+	var data map[string]interface{}
+
+	if err := json.Unmarshal([]byte(line), &data); err != nil || data == nil {
+		plain := p.plain(line)
+
+		// Flag the lines that look like broken JSON objects
+		if err != nil && strings.HasPrefix(strings.TrimSpace(line), "{") {
+			plain["json_parse_error"] = true
+			if p.errorDetail {
+				plain["json_parse_error_message"] = err.Error()
+			}
+		}
+
+		return plain
+	}
+
+	// Objects over the limits are shipped as plain text
+	if exceeded := p.exceededLimit(data); exceeded != "" {
+		plain := p.plain(line)
+		plain["json_limit_exceeded"] = exceeded
+		return plain
+	}
+
+	if p.sanitize {
+		data = sanitizeKeys(data).(map[string]interface{})
+	}
+
+	data = p.normalize(data)
+
+	data = p.separate(data)
+
+	if p.rawKey != "" {
+		data[p.rawKey] = line
+	}
+
+	return data
+}
+
+// Set a field we add to the event, an application field with the same key
+// is overwritten, renamed to key_app, dropped or kept under the conflict key
+func (p *messageParser) set(data map[string]interface{}, key string, value interface{}) {
+	if existing, ok := data[key]; ok {
+		collisions := atomic.AddInt64(&p.collisions, 1)
+		debug("http: field collision:", key, "total:", collisions)
+		p.metrics.count("collisions", 1, "field", key)
+
+		switch p.collision {
+		case "rename":
+			data[key+"_app"] = existing
+		case "nest":
+			conflicts, ok := data[p.conflictKey].(map[string]interface{})
+			if !ok {
+				conflicts = map[string]interface{}{}
+				data[p.conflictKey] = conflicts
+			}
+			conflicts[key] = existing
+		}
+	}
+
+	data[key] = value
+}
+
+// Replace the dots of the keys with underscores and strip their leading
+// underscores and invalid characters, at every level
+func sanitizeKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		sanitized := make(map[string]interface{}, len(v))
+		for k, nested := range v {
+			key := strings.Replace(k, ".", "_", -1)
+			key = strings.TrimLeft(invalidKeyChars.ReplaceAllString(key, ""), "_")
+			if key == "" {
+				key = "field"
+			}
+			sanitized[key] = sanitizeKeys(nested)
+		}
+		return sanitized
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = sanitizeKeys(nested)
+		}
+		return v
+	}
+
+	return value
+}
+
+// Normalize the case of the keys at every level
+func (p *messageParser) normalize(data map[string]interface{}) map[string]interface{} {
+	switch p.keyCase {
+	case "lower":
+		return transformKeys(data, strings.ToLower).(map[string]interface{})
+	case "snake":
+		return transformKeys(data, snakeCase).(map[string]interface{})
+	}
+
+	return data
+}
+
+func transformKeys(value interface{}, transform func(string) string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		transformed := make(map[string]interface{}, len(v))
+		for k, nested := range v {
+			transformed[transform(k)] = transformKeys(nested, transform)
+		}
+		return transformed
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = transformKeys(nested, transform)
+		}
+		return v
+	}
+
+	return value
+}
+
+// Convert a key to snake_case: RequestId, requestID and request-id all
+// become request_id
+func snakeCase(key string) string {
+	runes := []rune(key)
+	var out []rune
+
+	for i, r := range runes {
+		switch {
+		case r == '-' || r == ' ':
+			r = '_'
+		case unicode.IsUpper(r):
+			// Start a word at a lower to upper change and at the last
+			// upper of an acronym followed by a lower, as in HTTPStatus
+			if i > 0 && runes[i-1] != '_' && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				out = append(out, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		out = append(out, r)
+	}
+
+	return string(out)
+}
+
+// Prefix the application fields or nest them under a single key
+func (p *messageParser) separate(data map[string]interface{}) map[string]interface{} {
+	if p.prefix != "" {
+		prefixed := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			prefixed[p.prefix+k] = v
+		}
+		data = prefixed
+	}
+
+	if p.nest != "" {
+		data = map[string]interface{}{p.nest: data}
+	}
+
+	return data
+}
+
+// Check the parsed object against the limits, returns the exceeded one
+func (p *messageParser) exceededLimit(data map[string]interface{}) string {
+	if p.maxDepth == 0 && p.maxKeys == 0 && p.maxBytes == 0 {
+		return ""
+	}
+
+	depth, keys, size := measureJSON(data)
+	switch {
+	case p.maxDepth > 0 && depth > p.maxDepth:
+		return "depth"
+	case p.maxKeys > 0 && keys > p.maxKeys:
+		return "keys"
+	case p.maxBytes > 0 && size > p.maxBytes:
+		return "bytes"
+	}
+
+	return ""
+}
+
+// Measure the nesting depth, number of keys and bytes of keys and string
+// values of a parsed JSON value
+func measureJSON(value interface{}) (depth int, keys int, size int) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, nested := range v {
+			d, n, s := measureJSON(nested)
+			if d > depth {
+				depth = d
+			}
+			keys += n + 1
+			size += s + len(k)
+		}
+		depth++
+	case []interface{}:
+		for _, nested := range v {
+			d, n, s := measureJSON(nested)
+			if d > depth {
+				depth = d
+			}
+			keys += n
+			size += s
+		}
+		depth++
+	case string:
+		size = len(v)
+	}
+
+	return depth, keys, size
+}
+
+// Create an event holding the line as its message
+func (p *messageParser) plain(line string) map[string]interface{} {
+	return map[string]interface{}{p.messageKey: line}
+}
+
+// Level of an event, lowercased, from the level field of JSON logs or the
+// first uppercase level word of plain lines
+func lineLevel(data map[string]interface{}, levelKey string, messageKey string) string {
+	if level, ok := data[levelKey].(string); ok {
+		return strings.ToLower(level)
+	}
+	if message, ok := data[messageKey].(string); ok {
+		return strings.ToLower(levelPattern.FindString(message))
+	}
+
+	return ""
+}
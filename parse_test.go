@@ -0,0 +1,79 @@
+package logspoutRancher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLimits(t *testing.T) {
+	for _, test := range []struct {
+		options  map[string]string
+		line     string
+		exceeded interface{}
+	}{
+		{map[string]string{}, `{"a":{"b":{"c":1}}}`, nil},
+		{map[string]string{"http.json.maxdepth": "3"}, `{"a":{"b":{"c":1}}}`, nil},
+		{map[string]string{"http.json.maxdepth": "2"}, `{"a":{"b":{"c":1}}}`, "depth"},
+		{map[string]string{"http.json.maxkeys": "3"}, `{"a":1,"b":[{"c":2}]}`, nil},
+		{map[string]string{"http.json.maxkeys": "2"}, `{"a":1,"b":[{"c":2}]}`, "keys"},
+		{map[string]string{"http.json.maxbytes": "6"}, `{"ab":"cdef"}`, nil},
+		{map[string]string{"http.json.maxbytes": "5"}, `{"ab":"cdef"}`, "bytes"},
+	} {
+		p := newMessageParser(test.options)
+		data := p.parse(test.line)
+
+		if exceeded := data["json_limit_exceeded"]; exceeded != test.exceeded {
+			t.Errorf("%v %s: expected %v exceeded, got %v", test.options, test.line, test.exceeded, exceeded)
+		}
+		if test.exceeded != nil && data["message"] != test.line {
+			t.Errorf("%v %s: expected the line as message, got %v", test.options, test.line, data["message"])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	p := newMessageParser(map[string]string{"http.json.error_detail": "true"})
+
+	if data := p.parse(`{"broken":`); data["json_parse_error"] != true || data["json_parse_error_message"] == nil {
+		t.Errorf("expected a flagged parse error, got %v", data)
+	}
+	if data := p.parse("plain text"); data["json_parse_error"] != nil || data["message"] != "plain text" {
+		t.Errorf("expected a plain message, got %v", data)
+	}
+}
+
+func TestCollisionModes(t *testing.T) {
+	for mode, expected := range map[string]map[string]interface{}{
+		"overwrite": {"docker": "added"},
+		"drop":      {"docker": "added"},
+		"rename":    {"docker": "added", "docker_app": "application"},
+		"nest":      {"docker": "added", "clashes": map[string]interface{}{"docker": "application"}},
+		"unknown":   {"docker": "added"},
+	} {
+		p := newMessageParser(map[string]string{"http.collision": mode, "http.collision.key": "clashes"})
+		data := p.parse(`{"docker":"application"}`)
+		delete(data, "message")
+		p.set(data, "docker", "added")
+
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("%s: expected %v, got %v", mode, expected, data)
+		}
+		if p.collisions != 1 {
+			t.Errorf("%s: expected 1 collision, got %d", mode, p.collisions)
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for key, expected := range map[string]string{
+		"RequestId":  "request_id",
+		"requestID":  "request_id",
+		"request-id": "request_id",
+		"HTTPStatus": "http_status",
+		"status2xx":  "status2xx",
+	} {
+		if got := snakeCase(key); got != expected {
+			t.Errorf("%s: expected %s, got %s", key, expected, got)
+		}
+	}
+}
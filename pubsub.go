@@ -0,0 +1,134 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gliderlabs/logspout/router"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Pub/Sub accepts at most 1000 messages per publish request
+const pubsubMaxMessages = 1000
+
+// pubsubSink publishes events to a Google Cloud Pub/Sub topic through the
+// REST API, authenticated with a service account key or the Application
+// Default Credentials
+type pubsubSink struct {
+	client *http.Client
+	url    string
+}
+
+// A Pub/Sub message of a publish request
+type pubsubMessage struct {
+	Data        string            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+// NewPubSubAdapter creates an adapter publishing to pubsub://project/topic
+func NewPubSubAdapter(route *router.Route) (router.LogAdapter, error) {
+	parts := strings.SplitN(route.Address, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("pubsub: address must be project/topic: %s", route.Address)
+	}
+
+	// A service account key of the route, or the default credentials
+	var client *http.Client
+	if file := getStringParameter(route.Options, "pubsub.credentials", ""); file != "" {
+		key, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("pubsub: cannot read credentials: %s", err)
+		}
+		credentials, err := google.CredentialsFromJSON(context.Background(), key, "https://www.googleapis.com/auth/pubsub")
+		if err != nil {
+			return nil, fmt.Errorf("pubsub: invalid credentials %s: %s", file, err)
+		}
+		client = oauth2.NewClient(context.Background(), credentials.TokenSource)
+	} else {
+		var err error
+		client, err = google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/pubsub")
+		if err != nil {
+			return nil, fmt.Errorf("pubsub: cannot find default credentials: %s", err)
+		}
+	}
+
+	// Ordering keys need a regional endpoint, e.g. https://us-east1-pubsub.googleapis.com
+	endpoint := getStringParameter(route.Options, "pubsub.endpoint", "https://pubsub.googleapis.com")
+	url := fmt.Sprintf("%s/v1/projects/%s/topics/%s:publish", endpoint, parts[0], parts[1])
+	debug("pubsub: url:", url)
+
+	adapter := newAdapter(route)
+	adapter.sink = &pubsubSink{client: client, url: url}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Publish the batch, the rancher metadata become message attributes and
+// the container ID the ordering key
+func (s *pubsubSink) send(buffer []*map[string]interface{}) error {
+	messages := make([]pubsubMessage, 0, len(buffer))
+
+	for _, data := range buffer {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		meta := newTemplateData(*data)
+		messages = append(messages, pubsubMessage{
+			Data: base64.StdEncoding.EncodeToString(payload),
+			Attributes: map[string]string{
+				"stack":       meta.Stack,
+				"service":     meta.Service,
+				"container":   meta.Container,
+				"containerId": meta.ContainerID,
+				"hostname":    meta.Hostname,
+			},
+			OrderingKey: meta.ContainerID,
+		})
+	}
+
+	for len(messages) > 0 {
+		n := len(messages)
+		if n > pubsubMaxMessages {
+			n = pubsubMaxMessages
+		}
+		if err := s.publish(messages[:n]); err != nil {
+			return err
+		}
+		messages = messages[n:]
+	}
+
+	return nil
+}
+
+func (s *pubsubSink) publish(messages []pubsubMessage) error {
+	payload, err := json.Marshal(map[string]interface{}{"messages": messages})
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	response, err := s.client.Post(s.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error on publish: %s", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("publish response not 200 but %d: %s", response.StatusCode, body)
+	}
+	io.Copy(ioutil.Discard, response.Body)
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package logspoutRancher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"text/template"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// pulsarSink publishes events to a topic per stack/service, keyed by
+// container ID so the lines of a container stay ordered
+type pulsarSink struct {
+	client    pulsar.Client
+	topic     *template.Template
+	options   pulsar.ProducerOptions
+	producers map[string]pulsar.Producer
+	mutex     sync.Mutex
+}
+
+// NewPulsarAdapter creates an adapter publishing to Apache Pulsar
+func NewPulsarAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newAdapter(route)
+
+	// pulsar+ssl://broker:6651 connects over TLS
+	scheme := "pulsar"
+	if route.AdapterTransport("") == "ssl" {
+		scheme = "pulsar+ssl"
+	}
+
+	clientOptions := pulsar.ClientOptions{
+		URL:                        fmt.Sprintf("%s://%s", scheme, route.Address),
+		TLSTrustCertsFilePath:      getStringParameter(route.Options, "pulsar.tls.ca", ""),
+		TLSAllowInsecureConnection: getStringParameter(route.Options, "pulsar.tls.skipverify", "false") == "true",
+	}
+
+	// Token authentication, or TLS client certificate authentication
+	if token := getStringParameter(route.Options, "pulsar.token", ""); token != "" {
+		clientOptions.Authentication = pulsar.NewAuthenticationToken(token)
+	} else if tokenFile := getStringParameter(route.Options, "pulsar.token.file", ""); tokenFile != "" {
+		clientOptions.Authentication = pulsar.NewAuthenticationTokenFromFile(tokenFile)
+	} else if cert := getStringParameter(route.Options, "pulsar.tls.cert", ""); cert != "" {
+		clientOptions.Authentication = pulsar.NewAuthenticationTLS(
+			cert, getStringParameter(route.Options, "pulsar.tls.key", ""))
+	}
+
+	client, err := pulsar.NewClient(clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("pulsar: cannot create client: %s", err)
+	}
+	debug("pulsar: url:", clientOptions.URL)
+
+	adapter.sink = &pulsarSink{
+		client: client,
+		topic: parseTemplate("pulsar.topic", getStringParameter(route.Options,
+			"pulsar.topic", "persistent://public/default/{{.Stack}}-{{.Service}}")),
+		// Producer batches follow the buffer settings of the adapter
+		options: pulsar.ProducerOptions{
+			BatchingMaxMessages:     uint(adapter.capacity),
+			BatchingMaxPublishDelay: adapter.timeout,
+			BatcherBuilderType:      pulsar.KeyBasedBatchBuilder,
+		},
+		producers: make(map[string]pulsar.Producer),
+	}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Get the producer of a topic, creating it on first use
+func (s *pulsarSink) producer(topic string) (pulsar.Producer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if producer, ok := s.producers[topic]; ok {
+		return producer, nil
+	}
+
+	options := s.options
+	options.Topic = topic
+	producer, err := s.client.CreateProducer(options)
+	if err != nil {
+		return nil, err
+	}
+	s.producers[topic] = producer
+
+	return producer, nil
+}
+
+// Publish the batch and wait for the broker to acknowledge every event
+func (s *pulsarSink) send(buffer []*map[string]interface{}) error {
+	var wg sync.WaitGroup
+	var sendErr error
+	var errMutex sync.Mutex
+
+	used := make(map[string]pulsar.Producer)
+
+	for _, data := range buffer {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		topic := renderTemplate(s.topic, *data)
+		producer, err := s.producer(topic)
+		if err != nil {
+			return fmt.Errorf("cannot create producer for %s: %s", topic, err)
+		}
+		used[topic] = producer
+
+		message := &pulsar.ProducerMessage{Payload: payload}
+		message.Key = newTemplateData(*data).ContainerID
+
+		wg.Add(1)
+		producer.SendAsync(context.Background(), message,
+			func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+				if err != nil {
+					errMutex.Lock()
+					sendErr = err
+					errMutex.Unlock()
+				}
+				wg.Done()
+			})
+	}
+
+	for _, producer := range used {
+		if err := producer.Flush(); err != nil {
+			debug("pulsar: error on flush:", err)
+		}
+	}
+	wg.Wait()
+
+	if sendErr != nil {
+		return fmt.Errorf("error on publish: %s", sendErr)
+	}
+
+	return nil
+}
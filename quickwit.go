@@ -0,0 +1,102 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"text/template"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Quickwit rejects ingest requests over 10MB
+const quickwitMaxRequestBytes = 10 * 1024 * 1024
+
+// Characters not allowed in Quickwit index IDs
+var invalidQuickwitChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// quickwitFormat posts NDJSON to the ingest API of an index per
+// stack/service
+type quickwitFormat struct {
+	url    string
+	index  *template.Template
+	commit string
+}
+
+// NewQuickwitAdapter creates an adapter ingesting into Quickwit, e.g.
+// quickwit://quickwit:7280
+func NewQuickwitAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newHTTPAdapter(route)
+
+	format := &quickwitFormat{
+		url: adapter.url,
+		index: parseTemplate("quickwit.index", getStringParameter(route.Options,
+			"quickwit.index", "logs-{{.Stack}}-{{.Service}}")),
+		// auto returns once the documents are queued, wait_for once they are searchable
+		commit: getStringParameter(route.Options, "quickwit.commit", "auto"),
+	}
+	debug("quickwit: url:", format.url, "commit:", format.commit)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// ID of the index of an event, index IDs start with a letter
+func (f *quickwitFormat) indexId(data map[string]interface{}) string {
+	id := invalidQuickwitChars.ReplaceAllString(renderTemplate(f.index, data), "-")
+	if id == "" || !(id[0] >= 'a' && id[0] <= 'z' || id[0] >= 'A' && id[0] <= 'Z') {
+		id = "logs-" + id
+	}
+
+	return id
+}
+
+// Encode the batch as one request per index, split under the request size
+// limit
+func (f *quickwitFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	var payloads []*httpPayload
+	bodies := make(map[string]*bytes.Buffer)
+	var indexes []string
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		index := f.indexId(*data)
+		body, ok := bodies[index]
+		if !ok {
+			body = new(bytes.Buffer)
+			bodies[index] = body
+			indexes = append(indexes, index)
+		}
+
+		if body.Len() > 0 && body.Len()+len(event)+1 > quickwitMaxRequestBytes {
+			payloads = append(payloads, f.payload(index, body.Bytes()))
+			body = new(bytes.Buffer)
+			bodies[index] = body
+		}
+		body.Write(event)
+		body.WriteByte('\n')
+	}
+
+	for _, index := range indexes {
+		if bodies[index].Len() > 0 {
+			payloads = append(payloads, f.payload(index, bodies[index].Bytes()))
+		}
+	}
+
+	return payloads, nil
+}
+
+func (f *quickwitFormat) payload(index string, body []byte) *httpPayload {
+	return &httpPayload{
+		url:         fmt.Sprintf("%s/api/v1/%s/ingest?commit=%s", f.url, index, f.commit),
+		contentType: "application/x-ndjson",
+		body:        body,
+	}
+}
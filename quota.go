@@ -0,0 +1,147 @@
+package logspoutRancher
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Labels overriding the quota of a container
+const (
+	quotaLinesLabel = "logspout.quota.lines"
+	quotaBytesLabel = "logspout.quota.bytes"
+)
+
+// Quota event data for event data
+type QuotaEvent struct {
+	Lines           int    `json:"lines,omitempty"`
+	Bytes           int    `json:"bytes,omitempty"`
+	Interval        string `json:"interval"`
+	SuppressedLines int    `json:"suppressedLines"`
+	SuppressedBytes int    `json:"suppressedBytes"`
+}
+
+// logQuota limits the lines and bytes each container ships per interval,
+// protecting shared pipelines from a runaway service
+type logQuota struct {
+	lines    int
+	bytes    int
+	interval time.Duration
+	windows  map[string]*quotaWindow
+	mutex    sync.Mutex
+}
+
+// The usage of a container in the current interval
+type quotaWindow struct {
+	container       *docker.Container
+	lines           int
+	bytes           int
+	maxLines        int
+	maxBytes        int
+	suppressedLines int
+	suppressedBytes int
+}
+
+// Create the quota from the http.quota.* options, nil without limits
+func newLogQuota(options map[string]string) *logQuota {
+	q := &logQuota{
+		lines:    getIntParameter(options, "http.quota.lines", 0),
+		bytes:    getIntParameter(options, "http.quota.bytes", 0),
+		interval: getDurationParameter(options, "http.quota.interval", time.Minute),
+		windows:  make(map[string]*quotaWindow),
+	}
+	if q.lines <= 0 && q.bytes <= 0 {
+		return nil
+	}
+
+	return q
+}
+
+// Limit of a container, from its label or the route
+func labelLimit(c *docker.Container, label string, dflt int) int {
+	if value, ok := c.Config.Labels[label]; ok {
+		if limit, err := strconv.Atoi(value); err == nil {
+			return limit
+		}
+		debug("http: quota: invalid label value:", label, value)
+	}
+
+	return dflt
+}
+
+// Count a line of a container, false when it exceeds the quota and must be
+// suppressed
+func (q *logQuota) allow(c *docker.Container, size int) bool {
+	if q == nil {
+		return true
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	w, ok := q.windows[c.ID]
+	if !ok {
+		w = &quotaWindow{
+			container: c,
+			maxLines:  labelLimit(c, quotaLinesLabel, q.lines),
+			maxBytes:  labelLimit(c, quotaBytesLabel, q.bytes),
+		}
+		q.windows[c.ID] = w
+	}
+
+	if w.suppressedLines > 0 ||
+		(w.maxLines > 0 && w.lines+1 > w.maxLines) ||
+		(w.maxBytes > 0 && w.bytes+size > w.maxBytes) {
+		w.suppressedLines++
+		w.suppressedBytes += size
+		return false
+	}
+
+	w.lines++
+	w.bytes += size
+
+	return true
+}
+
+// Start a new interval every interval, and queue an event for each
+// container whose lines were suppressed in the last one
+func (a *HTTPAdapter) rollQuota() {
+	for range time.Tick(a.quota.interval) {
+		a.quota.mutex.Lock()
+		windows := a.quota.windows
+		a.quota.windows = make(map[string]*quotaWindow)
+		a.quota.mutex.Unlock()
+
+		for _, w := range windows {
+			if w.suppressedLines > 0 {
+				a.queueQuotaEvent(w)
+			}
+		}
+	}
+}
+
+func (a *HTTPAdapter) queueQuotaEvent(w *quotaWindow) {
+	debug("http: quota: suppressed", w.suppressedLines, "lines of", w.container.Name)
+	a.audit.record(w.container.Name, w.container.ID, dropQuota, w.suppressedLines)
+	a.metrics.count("dropped", int64(w.suppressedLines), "reason", dropQuota)
+
+	data := map[string]interface{}{
+		a.parser.messageKey: fmt.Sprintf("quota exceeded, %d lines suppressed", w.suppressedLines),
+		"quota": QuotaEvent{
+			Lines:           w.maxLines,
+			Bytes:           w.maxBytes,
+			Interval:        a.quota.interval.String(),
+			SuppressedLines: w.suppressedLines,
+			SuppressedBytes: w.suppressedBytes,
+		},
+	}
+
+	if !a.enrich(data, w.container) {
+		return
+	}
+
+	a.queue <- &data
+}
@@ -0,0 +1,53 @@
+package logspoutRancher
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+func TestLogQuota(t *testing.T) {
+	if newLogQuota(map[string]string{}) != nil {
+		t.Error("expected no quota without limits")
+	}
+
+	for _, test := range []struct {
+		options map[string]string
+		labels  map[string]string
+		sizes   []int
+		allowed []bool
+	}{
+		{map[string]string{"http.quota.lines": "2"}, nil,
+			[]int{1, 1, 1}, []bool{true, true, false}},
+		{map[string]string{"http.quota.bytes": "10"}, nil,
+			[]int{6, 6, 2}, []bool{true, false, false}},
+		{map[string]string{"http.quota.lines": "2"}, map[string]string{quotaLinesLabel: "3"},
+			[]int{1, 1, 1, 1}, []bool{true, true, true, false}},
+		{map[string]string{"http.quota.lines": "2"}, map[string]string{quotaLinesLabel: "many"},
+			[]int{1, 1, 1}, []bool{true, true, false}},
+	} {
+		q := newLogQuota(test.options)
+		c := &docker.Container{ID: "3f4e", Name: "/web-1", Config: &docker.Config{Labels: test.labels}}
+
+		for i, size := range test.sizes {
+			if allowed := q.allow(c, size); allowed != test.allowed[i] {
+				t.Errorf("%v %v: line %d: expected %v, got %v", test.options, test.labels, i, test.allowed[i], allowed)
+			}
+		}
+	}
+}
+
+func TestLogQuotaSuppression(t *testing.T) {
+	q := newLogQuota(map[string]string{"http.quota.lines": "1"})
+	c := &docker.Container{ID: "3f4e", Name: "/web-1", Config: &docker.Config{}}
+
+	q.allow(c, 5)
+	q.allow(c, 7)
+	q.allow(c, 9)
+
+	w := q.windows[c.ID]
+	if w.lines != 1 || w.suppressedLines != 2 || w.suppressedBytes != 16 {
+		t.Errorf("expected 1 line and 2 suppressed of 16 bytes, got %d, %d and %d",
+			w.lines, w.suppressedLines, w.suppressedBytes)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/rancherio/go-rancher/v2"
 	"log"
 	"os"
+	"sync"
 )
 
 // Setting package global Rancher API setting
@@ -12,20 +13,49 @@ var cattleUrl = os.Getenv("CATTLE_URL")
 var cattleAccessKkey = os.Getenv("CATTLE_ACCESS_KEY")
 var cattleSecretKey = os.Getenv("CATTLE_SECRET_KEY")
 
-var rancher *client.RancherClient
-var cCache map[string]*RancherInfo
+// rancherMetadata looks up the rancher metadata of containers through a
+// Rancher API and caches it. Routes using the same API share one
+type rancherMetadata struct {
+	client *client.RancherClient
+	cache  map[string]*RancherInfo
+	mutex  sync.RWMutex
+}
+
+var rancherApis = make(map[string]*rancherMetadata)
+var rancherApisMutex sync.Mutex
+
+// Get the Rancher API of a route, the rancher.url, rancher.access_key and
+// rancher.secret_key options override CATTLE_URL, CATTLE_ACCESS_KEY and
+// CATTLE_SECRET_KEY. Without a Rancher API the events only carry the docker
+// and label metadata
+func rancherFor(options map[string]string) *rancherMetadata {
+	url := getStringParameter(options, "rancher.url", cattleUrl)
+	accessKey := getStringParameter(options, "rancher.access_key", cattleAccessKkey)
+	secretKey := getStringParameter(options, "rancher.secret_key", cattleSecretKey)
+
+	rancherApisMutex.Lock()
+	defer rancherApisMutex.Unlock()
+
+	key := url + "\x00" + accessKey
+	if r, ok := rancherApis[key]; ok {
+		return r
+	}
+
+	r := &rancherMetadata{cache: make(map[string]*RancherInfo)}
+	if url != "" {
+		r.client = initRancherClient(url, accessKey, secretKey)
+	}
+	rancherApis[key] = r
 
-func init() {
-	rancher = initRancherClient()
-	cCache = make(map[string]*RancherInfo)
+	return r
 }
 
-func initRancherClient() *client.RancherClient {
+func initRancherClient(url string, accessKey string, secretKey string) *client.RancherClient {
 
 	config := &client.ClientOpts{
-		Url:       cattleUrl,
-		AccessKey: cattleAccessKkey,
-		SecretKey: cattleSecretKey,
+		Url:       url,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
 	}
 
 	r, err := client.NewRancherClient(config)
@@ -38,17 +68,18 @@ func initRancherClient() *client.RancherClient {
 }
 
 // Uses the passed docker id to find the rancher Id
-func GetRancherId(cID string) *client.Container {
+func (r *rancherMetadata) GetRancherId(cID string) *client.Container {
 
 	// This adds a filter to search for the specific container we just received an event from
 	filters := map[string]interface{}{"externalId": cID}
 
 	listOpts := &client.ListOpts{Filters: filters}
 
-	container, err := rancher.Container.List(listOpts)
+	container, err := r.client.Container.List(listOpts)
 
 	if err != nil {
 		log.Print(err)
+		return nil
 	}
 
 	// There should only ever be 1 container in the list thanks to our filter
@@ -61,47 +92,58 @@ func GetRancherId(cID string) *client.Container {
 }
 
 // Add the RancherInfo to the cache
-func Cache(con *RancherInfo) {
-	cCache[con.Container.DockerID] = con
+func (r *rancherMetadata) Cache(con *RancherInfo) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.cache[con.Container.DockerID] = con
 }
 
 // Check if the container data already exists in the cached map
-func ExistsInCache(containerID string) bool {
-	for k := range cCache {
-		if k == containerID {
-			return true
-		}
-	}
+func (r *rancherMetadata) ExistsInCache(containerID string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 
-	return false
+	_, ok := r.cache[containerID]
+
+	return ok
 }
 
 // Get the container data from the map
-func GetFromCache(cID string) *RancherInfo {
-	return cCache[cID]
+func (r *rancherMetadata) GetFromCache(cID string) *RancherInfo {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.cache[cID]
 }
 
-func DeleteFromCache(cId string) bool {
-	delete(cCache, cId)
+func (r *rancherMetadata) DeleteFromCache(cId string) bool {
+	r.mutex.Lock()
+	delete(r.cache, cId)
+	r.mutex.Unlock()
 
-	return ExistsInCache(cId)
+	return r.ExistsInCache(cId)
 }
 
 // Get the rancher meteadata from the api/cahce
-func GetRancherInfo(c *docker.Container) *RancherInfo {
+func (r *rancherMetadata) GetRancherInfo(c *docker.Container) *RancherInfo {
 	var rcontainer *client.Container
 
+	if r.client == nil {
+		return nil
+	}
+
 	// Check if we have added this container to cache before
-	if !ExistsInCache(c.ID) {
+	if !r.ExistsInCache(c.ID) {
 
 		// Pull rancher data from the API instead of the docker.sock
 		// First we use the docker id to pull the rancher container data
-		rcontainer = GetRancherId(c.ID)
+		rcontainer = r.GetRancherId(c.ID)
 
 		// Since its not in cache go get it
 		// Get container data, service data, and stack data if available
 		if rcontainer == nil {
-			del := DeleteFromCache(c.ID)
+			del := r.DeleteFromCache(c.ID)
 
 			if del {
 				log.Printf("Removed container ID %s from cache", c.ID)
@@ -125,14 +167,45 @@ func GetRancherInfo(c *docker.Container) *RancherInfo {
 
 		rancherInfo := &RancherInfo{
 			Container: container,
+			Stack:     r.GetRancherStack(rcontainer),
 		}
 
-		Cache(rancherInfo)
+		r.Cache(rancherInfo)
 
 		return rancherInfo
 	}
 
-	return GetFromCache(c.ID)
+	return r.GetFromCache(c.ID)
+}
+
+// Get the service and stack of the rancher container, nil for standalone containers
+func (r *rancherMetadata) GetRancherStack(rcontainer *client.Container) *RancherStack {
+	if rcontainer.StackId == "" {
+		return nil
+	}
+
+	stackInfo := &RancherStack{StackId: rcontainer.StackId}
+
+	stack, err := r.client.Stack.ById(rcontainer.StackId)
+	if err != nil {
+		log.Print(err)
+	} else if stack != nil {
+		stackInfo.StackName = stack.Name
+		stackInfo.StackState = stack.State
+	}
+
+	if len(rcontainer.ServiceIds) > 0 {
+		stackInfo.ServiceId = rcontainer.ServiceIds[0]
+
+		service, err := r.client.Service.ById(stackInfo.ServiceId)
+		if err != nil {
+			log.Print(err)
+		} else if service != nil {
+			stackInfo.Service = service.Name
+		}
+	}
+
+	return stackInfo
 }
 
 // Container Docker info for event data
@@ -146,26 +219,24 @@ type DockerInfo struct {
 // Rancher data for evetn data
 type RancherInfo struct {
 	Container *RancherContainer `json:"container,omitempty"`
-	//Stack     *RancherStack     `json:"stack,omitempty"`
+	Stack     *RancherStack     `json:"stack,omitempty"`
 }
 
 // Rancher container data for event
 type RancherContainer struct {
-	Name           string                 `json:"name"`
-	IP             string                 `json:"ip,omitempty"`
-	ID             string                 `json:"rancherId,omitempty"`
-	HostID         string                 `json:"hostId,omitempty"`
-	DockerID       string                 `json:"dockerId,omitempty"`
-	Labels         map[string]interface{} `json:"labels,omitempty"`
+	Name     string                 `json:"name"`
+	IP       string                 `json:"ip,omitempty"`
+	ID       string                 `json:"rancherId,omitempty"`
+	HostID   string                 `json:"hostId,omitempty"`
+	DockerID string                 `json:"dockerId,omitempty"`
+	Labels   map[string]interface{} `json:"labels,omitempty"`
 }
 
-// Rancher stack inf for event
-//type RancherStack struct {
-//	Service      string          `json:"service,omitempty"`
-//	ServiceId    string          `json:"ServiceId,omitempty"`
-//	StackId      string          `json:"StackId,omitempty"`
-//	StackName    string          `json:"stackName,omitempty"`
-//	StackState   string          `json:"stackState,omitempty"`
-//	DebugStack   *client.Stack   `json:"debugStack,omitempty"`
-//	DebugService *client.Service `json:"debugService,omitempty"`
-//}
+// Rancher stack info for event
+type RancherStack struct {
+	Service    string `json:"service,omitempty"`
+	ServiceId  string `json:"ServiceId,omitempty"`
+	StackId    string `json:"StackId,omitempty"`
+	StackName  string `json:"stackName,omitempty"`
+	StackState string `json:"stackState,omitempty"`
+}
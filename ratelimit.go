@@ -0,0 +1,60 @@
+package logspoutRancher
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket refilled at rate tokens per second, holding
+// at most one second of them
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+// Create a limiter of rate per second, nil without a limit
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{rate: rate, tokens: burst(rate), last: time.Now()}
+}
+
+// The tokens of a full bucket, at least one
+func burst(rate float64) float64 {
+	if rate < 1 {
+		return 1
+	}
+
+	return rate
+}
+
+// Take n tokens, sleeping until the bucket has refilled enough; a take
+// larger than the bucket waits for the tokens it lacks, a nil limiter
+// never waits
+func (l *rateLimiter) wait(n int) {
+	if l == nil || n < 1 {
+		return
+	}
+
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > burst(l.rate) {
+		l.tokens = burst(l.rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(0)
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
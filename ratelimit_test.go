@@ -0,0 +1,40 @@
+package logspoutRancher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	for rate, expected := range map[float64]float64{
+		0.5: 1,
+		1:   1,
+		20:  20,
+	} {
+		if got := burst(rate); got != expected {
+			t.Errorf("%v: expected a burst of %v, got %v", rate, expected, got)
+		}
+	}
+
+	if newRateLimiter(0) != nil {
+		t.Error("expected no limiter without a rate")
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	var l *rateLimiter
+	l.wait(1000)
+
+	l = newRateLimiter(100)
+	start := time.Now()
+	l.wait(100)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected the bucket to cover the first take, waited %s", elapsed)
+	}
+
+	start = time.Now()
+	l.wait(10)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("expected to wait for 10 tokens at 100/s, waited %s", elapsed)
+	}
+}
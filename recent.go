@@ -0,0 +1,198 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentEvents keeps the last events of each container in memory, served
+// on /recent as JSON or Server-Sent Events for when the pipeline is down
+type recentEvents struct {
+	containers  map[string]*recentRing
+	subscribers map[chan recentEvent]string
+	mutex       sync.RWMutex
+}
+
+// The last events of a container, oldest first from next
+type recentRing struct {
+	name   string
+	events [][]byte
+	next   int
+	full   bool
+}
+
+// An event with the ID of its container
+type recentEvent struct {
+	containerID string
+	event       []byte
+}
+
+var recent = &recentEvents{
+	containers:  make(map[string]*recentRing),
+	subscribers: make(map[chan recentEvent]string),
+}
+
+// NewRecentHandler serves the recent events, e.g. /recent lists the
+// containers, /recent?container=web-1 their events and with stream=true
+// follows them as Server-Sent Events
+func NewRecentHandler() http.Handler {
+	return http.HandlerFunc(recent.serve)
+}
+
+// Keep an event of a container in a ring of size events
+func (r *recentEvents) add(data map[string]interface{}, size int) {
+	meta := newTemplateData(data)
+	event, err := json.Marshal(data)
+	if err != nil {
+		debug("http: recent: error encoding JSON:", err)
+		return
+	}
+
+	r.mutex.Lock()
+	ring, ok := r.containers[meta.ContainerID]
+	if !ok || len(ring.events) != size {
+		ring = &recentRing{name: meta.Container, events: make([][]byte, size)}
+		r.containers[meta.ContainerID] = ring
+	}
+	ring.events[ring.next] = event
+	ring.next = (ring.next + 1) % size
+	if ring.next == 0 {
+		ring.full = true
+	}
+	r.mutex.Unlock()
+
+	r.mutex.RLock()
+	for subscriber, containerID := range r.subscribers {
+		if containerID == "" || containerID == meta.ContainerID {
+			select {
+			case subscriber <- recentEvent{meta.ContainerID, event}:
+			default:
+			}
+		}
+	}
+	r.mutex.RUnlock()
+}
+
+// Release the events of a removed container
+func (r *recentEvents) forget(containerID string) {
+	r.mutex.Lock()
+	delete(r.containers, containerID)
+	r.mutex.Unlock()
+}
+
+// ID of a container by name or ID
+func (r *recentEvents) lookup(container string) (string, bool) {
+	for id, ring := range r.containers {
+		if id == container || strings.HasPrefix(id, container) || ring.name == container {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// Events of a container, oldest first
+func (r *recentEvents) snapshot(containerID string) [][]byte {
+	ring := r.containers[containerID]
+	events := make([][]byte, 0, len(ring.events))
+	if ring.full {
+		events = append(events, ring.events[ring.next:]...)
+	}
+
+	return append(events, ring.events[:ring.next]...)
+}
+
+func (r *recentEvents) serve(w http.ResponseWriter, req *http.Request) {
+	container := req.URL.Query().Get("container")
+	stream := req.URL.Query().Get("stream") == "true" ||
+		strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+
+	r.mutex.RLock()
+	var containerID string
+	var events [][]byte
+	if container != "" {
+		var ok bool
+		if containerID, ok = r.lookup(container); !ok {
+			r.mutex.RUnlock()
+			http.Error(w, "no recent events for "+container, http.StatusNotFound)
+			return
+		}
+		events = r.snapshot(containerID)
+	} else if !stream {
+		// List the containers and how many events are kept for each
+		list := make([]map[string]interface{}, 0, len(r.containers))
+		for id, ring := range r.containers {
+			list = append(list, map[string]interface{}{
+				"id": id, "name": ring.name, "events": len(r.snapshot(id)),
+			})
+		}
+		r.mutex.RUnlock()
+		sort.Slice(list, func(i, j int) bool { return list[i]["name"].(string) < list[j]["name"].(string) })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+	r.mutex.RUnlock()
+
+	if !stream {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("["))
+		for i, event := range events {
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			w.Write(event)
+		}
+		w.Write([]byte("]\n"))
+		return
+	}
+
+	r.stream(w, req, containerID, events)
+}
+
+// Send the recent events then the new ones as Server-Sent Events
+func (r *recentEvents) stream(w http.ResponseWriter, req *http.Request, containerID string, events [][]byte) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	subscriber := make(chan recentEvent, 256)
+	r.mutex.Lock()
+	r.subscribers[subscriber] = containerID
+	r.mutex.Unlock()
+	defer func() {
+		r.mutex.Lock()
+		delete(r.subscribers, subscriber)
+		r.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, event := range events {
+		fmt.Fprintf(w, "data: %s\n\n", event)
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case e := <-subscriber:
+			fmt.Fprintf(w, "id: %s\ndata: %s\n\n", e.containerID, e.event)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package logspoutRancher
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisSink adds events to Redis streams, trimmed to a maximum length
+type redisSink struct {
+	client      *redis.Client
+	stream      *template.Template
+	maxLen      int64
+	approximate bool
+}
+
+// NewRedisAdapter creates an adapter adding to the streams of
+// redis://redis:6379, or redis+tls for TLS
+func NewRedisAdapter(route *router.Route) (router.LogAdapter, error) {
+	options := &redis.Options{
+		Addr:     route.Address,
+		Password: secretParameter(route.Options, "redis.password", "REDIS_PASSWORD"),
+		DB:       getIntParameter(route.Options, "redis.db", 0),
+	}
+	if route.AdapterTransport("") == "tls" {
+		options.TLSConfig = &tls.Config{}
+	}
+
+	client := redis.NewClient(options)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		debug("redis: cannot connect, will retry:", err)
+	}
+	debug("redis:", route.Address)
+
+	adapter := newAdapter(route)
+	adapter.sink = &redisSink{
+		client:      client,
+		stream:      parseTemplate("redis.stream", getStringParameter(route.Options, "redis.stream", "logs")),
+		maxLen:      int64(getIntParameter(route.Options, "redis.maxlen", 0)),
+		approximate: getStringParameter(route.Options, "redis.maxlen.approximate", "true") == "true",
+	}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Add the batch in a single pipeline, an event is the event field of its
+// stream entry
+func (s *redisSink) send(buffer []*map[string]interface{}) error {
+	ctx := context.Background()
+	pipeline := s.client.Pipeline()
+
+	for _, data := range buffer {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		args := &redis.XAddArgs{
+			Stream: renderTemplate(s.stream, *data),
+			Values: []interface{}{"event", payload},
+		}
+		if s.maxLen > 0 {
+			args.MaxLen = s.maxLen
+			args.Approx = s.approximate
+		}
+		pipeline.XAdd(ctx, args)
+	}
+
+	if _, err := pipeline.Exec(ctx); err != nil {
+		return fmt.Errorf("error on XADD: %s", err)
+	}
+
+	return nil
+}
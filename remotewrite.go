@@ -0,0 +1,167 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriter keeps the log counters as cumulative series and pushes them
+// to a Prometheus remote-write endpoint every interval, apart from the logs
+type remoteWriter struct {
+	url    string
+	header http.Header
+	prefix string
+	host   string
+	client *http.Client
+	series map[string]*remoteSeries
+	mutex  sync.Mutex
+}
+
+// A series, its labels sorted by name
+type remoteSeries struct {
+	labels [][2]string
+	value  float64
+}
+
+// Create a writer for a remote-write URL, e.g.
+// http://prometheus:9090/api/v1/write
+func newRemoteWriter(url string, options map[string]string) *remoteWriter {
+	host, _ := os.Hostname()
+	w := &remoteWriter{
+		url:    url,
+		header: http.Header{},
+		prefix: getStringParameter(options, "http.remotewrite.prefix", "logspout"),
+		host:   getStringParameter(options, "http.remotewrite.host", host),
+		client: &http.Client{Timeout: 30 * time.Second},
+		series: make(map[string]*remoteSeries),
+	}
+
+	if token := getStringParameter(options, "http.remotewrite.token", ""); token != "" {
+		w.header.Set("Authorization", "Bearer "+token)
+	} else if user := getStringParameter(options, "http.remotewrite.user", ""); user != "" {
+		request := &http.Request{Header: http.Header{}}
+		request.SetBasicAuth(user, getStringParameter(options, "http.remotewrite.password", ""))
+		w.header.Set("Authorization", request.Header.Get("Authorization"))
+	}
+
+	return w
+}
+
+// Add to a counter, e.g. logspout_lines_total{stack,service,level,host}
+func (w *remoteWriter) count(name string, n int64, tags ...string) {
+	labels := [][2]string{
+		{"__name__", w.prefix + "_" + name + "_total"},
+		{"host", w.host},
+	}
+	for i := 0; i+1 < len(tags); i += 2 {
+		labels = append(labels, [2]string{tags[i], tags[i+1]})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+
+	var key strings.Builder
+	for _, label := range labels {
+		key.WriteString(label[0] + "=" + label[1] + "\x00")
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	series, ok := w.series[key.String()]
+	if !ok {
+		series = &remoteSeries{labels: labels}
+		w.series[key.String()] = series
+	}
+	series.value += float64(n)
+}
+
+// Push the series every interval
+func (w *remoteWriter) run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := w.push(); err != nil {
+			debug("http: remotewrite:", err)
+		}
+	}
+}
+
+func (w *remoteWriter) push() error {
+	request := w.encode(time.Now())
+	if request == nil {
+		return nil
+	}
+
+	httpRequest, err := http.NewRequest("POST", w.url, bytes.NewReader(snappy.Encode(nil, request)))
+	if err != nil {
+		return fmt.Errorf("error on http.NewRequest: %s", err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/x-protobuf")
+	httpRequest.Header.Set("Content-Encoding", "snappy")
+	httpRequest.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range w.header {
+		httpRequest.Header[k] = v
+	}
+
+	response, err := w.client.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf("error on client.Do: %s", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("response not 2xx but %d: %s", response.StatusCode, body)
+	}
+	io.Copy(ioutil.Discard, response.Body)
+
+	return nil
+}
+
+// Encode the series as a remote-write WriteRequest protobuf message
+func (w *remoteWriter) encode(now time.Time) []byte {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.series) == 0 {
+		return nil
+	}
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+
+	var request []byte
+	for _, series := range w.series {
+		var timeseries []byte
+		for _, label := range series.labels {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, label[0])
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, label[1])
+
+			timeseries = protowire.AppendTag(timeseries, 1, protowire.BytesType)
+			timeseries = protowire.AppendBytes(timeseries, l)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(series.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp))
+		timeseries = protowire.AppendTag(timeseries, 2, protowire.BytesType)
+		timeseries = protowire.AppendBytes(timeseries, sample)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, timeseries)
+	}
+
+	return request
+}
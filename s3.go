@@ -0,0 +1,156 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// s3Sink accumulates events and periodically archives them to S3 as gzip
+// compressed NDJSON objects, one per key prefix
+type s3Sink struct {
+	client   *s3.S3
+	bucket   string
+	prefix   *template.Template
+	hostname string
+	maxBytes int
+	objects  map[string]*s3Object
+	mutex    sync.Mutex
+}
+
+// An object being accumulated
+type s3Object struct {
+	buffer *bytes.Buffer
+	writer *gzip.Writer
+	size   int
+}
+
+// NewS3Adapter creates an adapter archiving to s3://bucket
+func NewS3Adapter(route *router.Route) (router.LogAdapter, error) {
+	sess, err := newAWSSession(getStringParameter(route.Options, "aws.region", ""))
+	if err != nil {
+		return nil, fmt.Errorf("s3: cannot create session: %s", err)
+	}
+	hostname, _ := os.Hostname()
+
+	s := &s3Sink{
+		client:   s3.New(sess),
+		bucket:   route.Address,
+		prefix:   parseTemplate("s3.prefix", getStringParameter(route.Options, "s3.prefix", "logs/{{.Stack}}")),
+		hostname: hostname,
+		maxBytes: getIntParameter(route.Options, "s3.maxbytes", 64*1024*1024),
+		objects:  make(map[string]*s3Object),
+	}
+	interval := getDurationParameter(route.Options, "s3.interval", 5*time.Minute)
+	debug("s3: bucket:", s.bucket, "interval:", interval)
+
+	go func() {
+		for range time.Tick(interval) {
+			s.upload(false)
+		}
+	}()
+
+	adapter := newAdapter(route)
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Add the batch to the objects of their prefix, the objects grown past
+// s3.maxbytes are uploaded right away
+func (s *s3Sink) send(buffer []*map[string]interface{}) error {
+	s.mutex.Lock()
+	full := false
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			s.mutex.Unlock()
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		prefix := strings.Trim(renderTemplate(s.prefix, *data), "/")
+		object, ok := s.objects[prefix]
+		if !ok {
+			object = &s3Object{buffer: new(bytes.Buffer)}
+			object.writer = gzip.NewWriter(object.buffer)
+			s.objects[prefix] = object
+		}
+		object.writer.Write(event)
+		object.writer.Write([]byte{'\n'})
+		object.size += len(event) + 1
+		full = full || object.size >= s.maxBytes
+	}
+	s.mutex.Unlock()
+
+	// The events are accumulated already, a failed upload is retried with
+	// the next one rather than the batch
+	if full {
+		s.upload(true)
+	}
+
+	return nil
+}
+
+// Upload the accumulated objects, or only the full ones, under a key
+// partitioned by time and host; an object failing to upload is kept for
+// the next upload
+func (s *s3Sink) upload(fullOnly bool) {
+	s.mutex.Lock()
+	objects := make(map[string]*s3Object)
+	for prefix, object := range s.objects {
+		if !fullOnly || object.size >= s.maxBytes {
+			objects[prefix] = object
+			delete(s.objects, prefix)
+		}
+	}
+	s.mutex.Unlock()
+
+	now := time.Now().UTC()
+
+	for prefix, object := range objects {
+		object.writer.Close()
+		key := fmt.Sprintf("%s/%s/%s-%d.ndjson.gz", prefix, now.Format("2006/01/02/15"), s.hostname, now.UnixNano())
+
+		_, err := s.client.PutObject(&s3.PutObjectInput{
+			Bucket:          aws.String(s.bucket),
+			Key:             aws.String(key),
+			Body:            bytes.NewReader(object.buffer.Bytes()),
+			ContentType:     aws.String("application/x-ndjson"),
+			ContentEncoding: aws.String("gzip"),
+		})
+		if err != nil {
+			log.Println("s3: error on PutObject, keeping the events for the next upload:", key, err)
+			s.keep(prefix, object)
+			continue
+		}
+		debug("s3: uploaded", key, object.size, "bytes")
+	}
+}
+
+// Keep an object which failed to upload, ahead of the events accumulated
+// since, which are appended as another gzip member
+func (s *s3Sink) keep(prefix string, object *s3Object) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if current, ok := s.objects[prefix]; ok {
+		current.writer.Close()
+		object.buffer.Write(current.buffer.Bytes())
+		object.size += current.size
+	}
+	object.writer = gzip.NewWriter(object.buffer)
+	s.objects[prefix] = object
+}
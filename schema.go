@@ -0,0 +1,59 @@
+package logspoutRancher
+
+import "strings"
+
+// Layouts of the events, selected by http.schema_version and recorded in
+// the schema_version field so index templates can follow the format
+const (
+	// The layout of the first releases
+	schemaLegacy = 1
+	// The fields of JSON messages are nested under app
+	schemaNested = 2
+	// Elastic Common Schema names for the docker and orchestrator metadata,
+	// with the fields of JSON messages nested under app
+	schemaECS = 3
+)
+
+// ECS container fields
+type ecsContainer struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Image ecsImage `json:"image"`
+}
+
+type ecsImage struct {
+	Name string `json:"name"`
+}
+
+// Move an event to the layout of the adapter
+func (a *HTTPAdapter) applySchema(data map[string]interface{}) {
+	data["schema_version"] = a.schema
+	if a.schema != schemaECS {
+		return
+	}
+
+	meta := newTemplateData(data)
+	if info, ok := data["docker"].(DockerInfo); ok {
+		data["container"] = &ecsContainer{
+			ID:    info.ID,
+			Name:  strings.TrimPrefix(info.Name, "/"),
+			Image: ecsImage{Name: info.Image},
+		}
+		data["host"] = map[string]string{"hostname": info.Hostname}
+		delete(data, "docker")
+	}
+
+	data["service"] = map[string]string{"name": meta.Service}
+	orchestrator := map[string]string{"namespace": meta.Stack}
+	for _, kind := range []string{"rancher", "swarm", "kubernetes", "compose"} {
+		if _, ok := data[kind]; ok {
+			orchestrator["type"] = kind
+			break
+		}
+	}
+	data["orchestrator"] = orchestrator
+
+	if level := lineLevel(data, "level", a.parser.messageKey); level != "" {
+		data["log"] = map[string]string{"level": level}
+	}
+}
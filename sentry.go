@@ -0,0 +1,153 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// sentryForwarder sends the error level lines to Sentry as a side channel
+// of the route, with the docker and rancher metadata as tags
+type sentryForwarder struct {
+	url        string
+	auth       string
+	client     *http.Client
+	levels     map[string]bool
+	levelKey   string
+	messageKey string
+	events     chan map[string]interface{}
+}
+
+// Create a forwarder for a DSN, e.g. https://key@o1.ingest.sentry.io/42
+func newSentryForwarder(dsn string, options map[string]string, messageKey string) (*sentryForwarder, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("no public key in %s", dsn)
+	}
+	project := strings.TrimPrefix(u.Path, "/")
+	if project == "" {
+		return nil, fmt.Errorf("no project in %s", dsn)
+	}
+
+	s := &sentryForwarder{
+		url: fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project),
+		auth: fmt.Sprintf("Sentry sentry_version=7, sentry_client=logspout-rancher/1.0, sentry_key=%s",
+			u.User.Username()),
+		client:     &http.Client{Timeout: 10 * time.Second},
+		levels:     make(map[string]bool),
+		levelKey:   getStringParameter(options, "http.sentry.level_key", "level"),
+		messageKey: messageKey,
+		events:     make(chan map[string]interface{}, 100),
+	}
+	for _, level := range strings.Split(getStringParameter(options, "http.sentry.levels", "error,fatal,critical,panic"), ",") {
+		s.levels[strings.ToLower(strings.TrimSpace(level))] = true
+	}
+
+	return s, nil
+}
+
+// Queue an event for Sentry when its level is one of the forwarded levels,
+// dropping it when Sentry can't keep up so the logs are never held back
+func (s *sentryForwarder) forward(data map[string]interface{}) {
+	if s == nil {
+		return
+	}
+
+	level := lineLevel(data, s.levelKey, s.messageKey)
+	if !s.levels[level] {
+		return
+	}
+
+	meta := newTemplateData(data)
+	message, _ := data[s.messageKey].(string)
+	if message == "" {
+		message = fmt.Sprintf("%s error", meta.Service)
+	}
+	if level == "critical" || level == "panic" {
+		level = "fatal"
+	}
+
+	extra := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		extra[k] = v
+	}
+
+	event := map[string]interface{}{
+		"event_id":  sentryEventId(),
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"level":     level,
+		"logger":    meta.Container,
+		"platform":  "other",
+		"message":   map[string]string{"formatted": message},
+		"tags": map[string]string{
+			"stack":        meta.Stack,
+			"service":      meta.Service,
+			"container":    meta.Container,
+			"container_id": meta.ContainerID,
+			"image":        meta.Image,
+			"hostname":     meta.Hostname,
+		},
+		"extra": extra,
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		debug("http: sentry: dropping event, queue full")
+	}
+}
+
+// Send the queued events to Sentry
+func (s *sentryForwarder) run() {
+	for event := range s.events {
+		if err := s.send(event); err != nil {
+			debug("http: sentry:", err)
+		}
+	}
+}
+
+func (s *sentryForwarder) send(event map[string]interface{}) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	request, err := http.NewRequest("POST", s.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error on http.NewRequest: %s", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Sentry-Auth", s.auth)
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error on client.Do: %s", err)
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode != 200 {
+		return fmt.Errorf("response not 200 but %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// A random event ID, 32 hex characters
+func sentryEventId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
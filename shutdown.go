@@ -0,0 +1,100 @@
+package logspoutRancher
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// shutdownHook flushes the buffers of the routes when logspout is asked to
+// stop, before letting the signal terminate the process
+type shutdownHook struct {
+	adapters []*HTTPAdapter
+	mutex    sync.Mutex
+	once     sync.Once
+}
+
+var shutdown = &shutdownHook{}
+
+// Register an adapter, the first one installs the signal handler
+func (h *shutdownHook) register(a *HTTPAdapter) {
+	h.mutex.Lock()
+	h.adapters = append(h.adapters, a)
+	h.mutex.Unlock()
+
+	h.once.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		go h.wait(signals)
+	})
+}
+
+// Drain every route in parallel, each within its own deadline, then raise
+// the signal again with its default behaviour
+func (h *shutdownHook) wait(signals chan os.Signal) {
+	sig := <-signals
+
+	h.mutex.Lock()
+	adapters := h.adapters
+	h.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, a := range adapters {
+		wg.Add(1)
+		go func(a *HTTPAdapter) {
+			defer wg.Done()
+			a.drain()
+		}(a)
+	}
+	wg.Wait()
+
+	signal.Reset(sig)
+	if s, ok := sig.(syscall.Signal); ok {
+		syscall.Kill(os.Getpid(), s)
+	}
+	os.Exit(1)
+}
+
+// Send what is left in the buffer and wait for the batches in flight, giving
+// up after http.shutdown.timeout; a spooled batch not delivered in time is
+// replayed on the next start
+func (a *HTTPAdapter) drain() {
+	a.bufferMutex.Lock()
+	buffer := append(a.requeued, a.buffer...)
+	a.buffer = make([]*map[string]interface{}, 0, a.capacity)
+	a.requeued = nil
+	spooled := a.spool.seal()
+	a.bufferMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// The spooled batch is kept for the next start unless the events
+		// were delivered or written to the dead letters
+		delivered := true
+		if len(buffer) > 0 {
+			if err := a.sendWithRetry(buffer); err != nil {
+				debug("http: route:", a.route.ID, "final flush failed:", err, a.route.Address)
+				buffer = a.settle(buffer)
+				delivered = a.deadletter.write(buffer)
+				a.divert(buffer)
+			} else {
+				a.metrics.count("shipped", int64(len(a.settle(buffer))))
+			}
+		}
+		if delivered {
+			a.spool.remove(spooled)
+		}
+		a.inflight.Wait()
+	}()
+
+	select {
+	case <-done:
+		debug("http: route:", a.route.ID, "flushed on shutdown, messages:", len(buffer))
+	case <-time.After(a.shutdownTimeout):
+		debug("http: route:", a.route.ID, "shutdown flush timed out after", a.shutdownTimeout)
+	}
+}
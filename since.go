@@ -0,0 +1,111 @@
+package logspoutRancher
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Parse the http.since option, an RFC3339 timestamp or a duration before now
+func parseSince(value string) (time.Time, error) {
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Now().Add(-duration), nil
+}
+
+// Request the logs of every running container from since up to the start
+// of the adapter, the later lines are delivered by logspout itself
+func (a *HTTPAdapter) backfillSince(since time.Time) {
+	containers, err := a.docker.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		debug("http: since: cannot list containers:", err)
+		return
+	}
+
+	for _, c := range containers {
+		container, err := a.docker.InspectContainer(c.ID)
+		if err != nil {
+			debug("http: since: cannot inspect container:", err, c.ID)
+			continue
+		}
+
+		a.backfillContainer(container, since)
+	}
+
+	debug("http: since: backfilled containers:", len(containers))
+}
+
+func (a *HTTPAdapter) backfillContainer(container *docker.Container, since time.Time) {
+	var wg sync.WaitGroup
+	stdout := a.backfillWriter(container, "stdout", &wg)
+	stderr := a.backfillWriter(container, "stderr", &wg)
+
+	err := a.docker.Logs(docker.LogsOptions{
+		Container:    container.ID,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Stdout:       true,
+		Stderr:       true,
+		Timestamps:   true,
+		Since:        since.Unix(),
+		RawTerminal:  container.Config.Tty,
+	})
+	if err != nil {
+		debug("http: since: cannot get container logs:", err, container.ID)
+	}
+
+	stdout.Close()
+	stderr.Close()
+	wg.Wait()
+}
+
+// Create a writer turning the timestamped log lines written to it into
+// messages for the stream
+func (a *HTTPAdapter) backfillWriter(container *docker.Container, source string, wg *sync.WaitGroup) io.WriteCloser {
+	reader, writer := io.Pipe()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			parts := strings.SplitN(line, " ", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			timestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+			if err != nil || !timestamp.Before(a.started) {
+				continue
+			}
+
+			a.backfill <- &router.Message{
+				Container: container,
+				Source:    source,
+				Data:      parts[1],
+				Time:      timestamp,
+			}
+		}
+
+		// Unblock the docker client if we stopped reading early
+		io.Copy(ioutil.Discard, reader)
+	}()
+
+	return writer
+}
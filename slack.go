@@ -0,0 +1,129 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// slackNotifier posts to a Slack incoming webhook when a pattern is seen,
+// at most once per interval for a service and pattern
+type slackNotifier struct {
+	webhook    string
+	patterns   []*regexp.Regexp
+	text       *template.Template
+	interval   time.Duration
+	messageKey string
+	metrics    *logMetrics
+	client     *http.Client
+	last       map[string]time.Time
+	suppressed map[string]int
+	messages   chan string
+}
+
+// Create a notifier from the http.slack.* options of a route, the patterns
+// are regular expressions separated by ;
+func newSlackNotifier(webhook string, options map[string]string, messageKey string) (*slackNotifier, error) {
+	s := &slackNotifier{
+		webhook: webhook,
+		text: parseTemplate("http.slack.template", getStringParameter(options, "http.slack.template",
+			fmt.Sprintf("*{{.Stack}}/{{.Service}}* `{{.Container}}`: {{index .Event %q}}", messageKey))),
+		interval:   getDurationParameter(options, "http.slack.interval", time.Minute),
+		messageKey: messageKey,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		last:       make(map[string]time.Time),
+		suppressed: make(map[string]int),
+		messages:   make(chan string, 100),
+	}
+
+	for _, pattern := range strings.Split(getStringParameter(options, "http.slack.patterns", "FATAL"), ";") {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		s.patterns = append(s.patterns, re)
+	}
+
+	return s, nil
+}
+
+// Notify the patterns the message of an event matches, the matches within
+// the interval of the last notification are only counted. Only called from
+// the Stream goroutine
+func (s *slackNotifier) observe(data map[string]interface{}) {
+	if s == nil {
+		return
+	}
+
+	message, ok := data[s.messageKey].(string)
+	if !ok {
+		return
+	}
+
+	for _, pattern := range s.patterns {
+		if !pattern.MatchString(message) {
+			continue
+		}
+
+		meta := newTemplateData(data)
+		key := meta.Stack + "/" + meta.Service + ":" + pattern.String()
+		s.metrics.count("slack_matches", 1, "stack", meta.Stack, "service", meta.Service, "pattern", pattern.String())
+		if time.Since(s.last[key]) < s.interval {
+			s.suppressed[key]++
+			continue
+		}
+
+		text := renderTemplate(s.text, data)
+		if n := s.suppressed[key]; n > 0 {
+			text += fmt.Sprintf(" (+%d more since the last notification)", n)
+		}
+		s.last[key] = time.Now()
+		delete(s.suppressed, key)
+
+		select {
+		case s.messages <- text:
+		default:
+			debug("http: slack: dropping notification, queue full:", key)
+		}
+	}
+}
+
+// Post the queued notifications to the webhook
+func (s *slackNotifier) run() {
+	for text := range s.messages {
+		if err := s.post(text); err != nil {
+			debug("http: slack:", err)
+		}
+	}
+}
+
+func (s *slackNotifier) post(text string) error {
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %s", err)
+	}
+
+	response, err := s.client.Post(s.webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error on client.Post: %s", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("response not 200 but %d: %s", response.StatusCode, body)
+	}
+	io.Copy(ioutil.Discard, response.Body)
+
+	return nil
+}
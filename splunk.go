@@ -0,0 +1,202 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// splunkFormat posts events to a Splunk HTTP Event Collector, waiting for
+// the indexer acknowledgment of each batch when enabled
+type splunkFormat struct {
+	url        string
+	ackUrl     string
+	header     http.Header
+	client     *http.Client
+	sourcetype *template.Template
+	source     *template.Template
+	index      string
+	ack        bool
+	ackTimeout time.Duration
+	retries    int
+}
+
+// An event of a HEC request
+type splunkEvent struct {
+	Time       string      `json:"time"`
+	Host       string      `json:"host,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	Sourcetype string      `json:"sourcetype,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Event      interface{} `json:"event"`
+}
+
+// A HEC response, the ackId is set when indexer acknowledgment is enabled
+type splunkResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckId *int64 `json:"ackId"`
+}
+
+// NewSplunkAdapter creates an adapter posting to a Splunk HTTP Event
+// Collector, e.g. splunk://splunk:8088
+func NewSplunkAdapter(route *router.Route) (router.LogAdapter, error) {
+	token := secretParameter(route.Options, "splunk.token", "SPLUNK_HEC_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("splunk: splunk.token is required")
+	}
+
+	adapter := newHTTPAdapter(route)
+	format := &splunkFormat{
+		url:        adapter.url + "/services/collector/event",
+		ackUrl:     adapter.url + "/services/collector/ack",
+		header:     http.Header{},
+		client:     adapter.client,
+		sourcetype: parseTemplate("splunk.sourcetype", getStringParameter(route.Options, "splunk.sourcetype", "_json")),
+		source:     parseTemplate("splunk.source", getStringParameter(route.Options, "splunk.source", "{{.Stack}}/{{.Service}}")),
+		index:      getStringParameter(route.Options, "splunk.index", ""),
+		ack:        getStringParameter(route.Options, "splunk.ack", "false") == "true",
+		ackTimeout: getDurationParameter(route.Options, "splunk.ack.timeout", time.Minute),
+		retries:    getIntParameter(route.Options, "splunk.ack.retries", 3),
+	}
+	format.header.Set("Authorization", "Splunk "+token)
+
+	// Acknowledgments are tracked per channel
+	if format.ack {
+		format.header.Set("X-Splunk-Request-Channel", splunkChannel())
+	}
+	debug("splunk: url:", format.url, "ack:", format.ack)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// A random channel identifier, formatted as a GUID
+func splunkChannel() string {
+	return newUUID()
+}
+
+// Encode the batch as concatenated HEC events, the host is the Rancher host
+// of the container and the time the @timestamp of the event
+func (f *splunkFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	var body bytes.Buffer
+
+	for _, data := range buffer {
+		timestamp := time.Now()
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			timestamp = t
+		}
+
+		meta := newTemplateData(*data)
+		event, err := json.Marshal(splunkEvent{
+			Time:       strconv.FormatFloat(float64(timestamp.UnixNano())/float64(time.Second), 'f', 3, 64),
+			Host:       meta.Hostname,
+			Source:     renderTemplate(f.source, *data),
+			Sourcetype: renderTemplate(f.sourcetype, *data),
+			Index:      f.index,
+			Event:      data,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		body.Write(event)
+	}
+
+	return []*httpPayload{{
+		url:         f.url,
+		contentType: "application/json",
+		header:      f.header,
+		body:        body.Bytes(),
+	}}, nil
+}
+
+// Check the HEC response, and wait for the indexers to acknowledge the
+// batch when enabled, a batch not acknowledged in time is sent again
+func (f *splunkFormat) check(payload *httpPayload, body []byte) (*httpPayload, error) {
+	var response splunkResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error decoding HEC response: %s", err)
+	}
+	if response.Code != 0 {
+		return nil, fmt.Errorf("HEC error %d: %s", response.Code, response.Text)
+	}
+	if !f.ack || response.AckId == nil {
+		return nil, nil
+	}
+
+	acked, err := f.waitForAck(*response.AckId)
+	if err != nil {
+		return nil, err
+	}
+	if acked {
+		return nil, nil
+	}
+
+	if payload.attempt >= f.retries {
+		return nil, fmt.Errorf("batch not acknowledged after %d retries", f.retries)
+	}
+	debug("splunk: resending batch not acknowledged, ackId:", *response.AckId)
+
+	return &httpPayload{
+		url:         payload.url,
+		contentType: payload.contentType,
+		header:      payload.header,
+		body:        payload.body,
+		attempt:     payload.attempt + 1,
+	}, nil
+}
+
+// Poll the ack endpoint until the batch is indexed or the timeout expires
+func (f *splunkFormat) waitForAck(ackId int64) (bool, error) {
+	query, err := json.Marshal(map[string][]int64{"acks": {ackId}})
+	if err != nil {
+		return false, fmt.Errorf("error encoding JSON: %s", err)
+	}
+	deadline := time.Now().Add(f.ackTimeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+
+		request, err := http.NewRequest("POST", f.ackUrl, bytes.NewReader(query))
+		if err != nil {
+			return false, fmt.Errorf("error on http.NewRequest: %s", err)
+		}
+		for k, v := range f.header {
+			request.Header[k] = v
+		}
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := f.client.Do(request)
+		if err != nil {
+			debug("splunk: error polling ack:", err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != 200 {
+			debug("splunk: ack response not 200 but", response.StatusCode)
+			continue
+		}
+
+		var acks struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if err := json.Unmarshal(body, &acks); err != nil {
+			return false, fmt.Errorf("error decoding ack response: %s", err)
+		}
+		if acks.Acks[strconv.FormatInt(ackId, 10)] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,184 @@
+package logspoutRancher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Name of the journal of the events not flushed yet
+const spoolJournal = "pending.ndjson"
+
+// diskBuffer journals the buffered events to a directory, a flushed batch
+// is sealed into its own file until it is delivered, so the events
+// survive a restart of logspout
+type diskBuffer struct {
+	dir     string
+	journal *os.File
+}
+
+// Open the spool of a directory, the journal left by a previous run is
+// sealed so it is replayed with the other batches
+func newDiskBuffer(dir string) (*diskBuffer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	d := &diskBuffer{dir: dir}
+	if _, err := os.Stat(filepath.Join(dir, spoolJournal)); err == nil {
+		if err := os.Rename(filepath.Join(dir, spoolJournal), d.batchName()); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *diskBuffer) open() error {
+	journal, err := os.OpenFile(filepath.Join(d.dir, spoolJournal), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	d.journal = journal
+
+	return nil
+}
+
+// Name of a new sealed batch, sorting by age
+func (d *diskBuffer) batchName() string {
+	return filepath.Join(d.dir, fmt.Sprintf("batch-%d.ndjson", time.Now().UnixNano()))
+}
+
+// Journal a buffered event, the caller holds the buffer mutex; a nil spool
+// writes nothing
+func (d *diskBuffer) append(data *map[string]interface{}) {
+	if d == nil || d.journal == nil {
+		return
+	}
+
+	event, err := json.Marshal(data)
+	if err != nil {
+		debug("http: spool: error encoding JSON:", err)
+		return
+	}
+	if _, err := d.journal.Write(append(event, '\n')); err != nil {
+		debug("http: spool: error writing event:", err)
+	}
+}
+
+// Seal the journal into a batch file as the buffer is flushed, the caller
+// holds the buffer mutex
+func (d *diskBuffer) seal() string {
+	if d == nil || d.journal == nil {
+		return ""
+	}
+
+	d.journal.Close()
+	name := d.batchName()
+	if err := os.Rename(filepath.Join(d.dir, spoolJournal), name); err != nil {
+		debug("http: spool: error sealing batch:", err)
+		name = ""
+	}
+	if err := d.open(); err != nil {
+		debug("http: spool: cannot reopen journal, events are no longer spooled:", err)
+		d.journal = nil
+	}
+
+	return name
+}
+
+// Remove a batch once it has been delivered, or handed to the failure path
+func (d *diskBuffer) remove(name string) {
+	if d == nil || name == "" {
+		return
+	}
+
+	os.Remove(name)
+}
+
+// List the sealed batches, oldest first
+func (d *diskBuffer) list() ([]string, error) {
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), "batch-") {
+			names = append(names, filepath.Join(d.dir, entry.Name()))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Read a sealed batch, the timestamps of the events are restored so the
+// sinks keep their original time
+func (d *diskBuffer) read(name string) ([]*map[string]interface{}, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var buffer []*map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var data map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+			// A line cut short by a crash
+			debug("http: spool: skipping undecodable event:", err, name)
+			continue
+		}
+		if value, ok := data["@timestamp"].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				data["@timestamp"] = t
+			}
+		}
+		buffer = append(buffer, &data)
+	}
+
+	return buffer, scanner.Err()
+}
+
+// Deliver the batches spooled by a previous run, stopping at the first one
+// which still fails so it is kept for the next start
+func (a *HTTPAdapter) replaySpool() {
+	names, err := a.spool.list()
+	if err != nil {
+		debug("http: spool: cannot list batches:", err)
+		return
+	}
+
+	for _, name := range names {
+		buffer, err := a.spool.read(name)
+		if err != nil {
+			debug("http: spool: cannot read batch:", err, name)
+			continue
+		}
+
+		if len(buffer) > 0 {
+			if err := a.sendWithRetry(buffer); err != nil {
+				a.settle(buffer)
+				debug("http: spool: replay stopped:", err, name)
+				return
+			}
+			a.metrics.count("shipped", int64(len(a.settle(buffer))))
+		}
+
+		a.spool.remove(name)
+		debug("http: spool: replayed batch:", name, "messages:", len(buffer))
+	}
+}
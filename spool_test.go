@@ -0,0 +1,39 @@
+package logspoutRancher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpoolReplayKeepsTemplateData(t *testing.T) {
+	spool, err := newDiskBuffer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string]interface{}{
+		"message":    "hello",
+		"@timestamp": time.Now(),
+		"docker":     DockerInfo{Name: "/web-1", ID: "3f4e", Image: "nginx", Hostname: "node-1"},
+		"rancher":    &RancherInfo{Stack: &RancherStack{StackName: "shop", Service: "web"}},
+	}
+	spool.append(&data)
+	name := spool.seal()
+
+	buffer, err := spool.read(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buffer) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(buffer))
+	}
+
+	topic := parseTemplate("topic", "{{.Stack}}.{{.Service}}.{{.Container}}.{{.ContainerID}}.{{.Hostname}}")
+	expected := renderTemplate(topic, data)
+	if expected != "shop.web.web-1.3f4e.node-1" {
+		t.Fatalf("unexpected rendering of the original event: %s", expected)
+	}
+	if replayed := renderTemplate(topic, *buffer[0]); replayed != expected {
+		t.Errorf("expected %s after replay, got %s", expected, replayed)
+	}
+}
@@ -0,0 +1,164 @@
+package logspoutRancher
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+	_ "modernc.org/sqlite"
+)
+
+// How often the retention and size cap of the archive are enforced
+const sqliteMaintenanceInterval = time.Minute
+
+// sqliteSink archives events in a local SQLite database, capped in size and
+// age so each host keeps a queryable short-term archive
+type sqliteSink struct {
+	db        *sql.DB
+	maxBytes  int64
+	retention time.Duration
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	time         INTEGER NOT NULL,
+	container_id TEXT,
+	container    TEXT,
+	stack        TEXT,
+	service      TEXT,
+	event        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_time ON events (time);
+CREATE INDEX IF NOT EXISTS events_service ON events (stack, service, time);
+`
+
+// NewSQLiteAdapter creates an adapter archiving to
+// sqlite:///var/lib/logspout/archive.db
+func NewSQLiteAdapter(route *router.Route) (router.LogAdapter, error) {
+	db, err := sql.Open("sqlite", route.Address)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: cannot open %s: %s", route.Address, err)
+	}
+	// SQLite has a single writer
+	db.SetMaxOpenConns(1)
+
+	// auto_vacuum only applies to a new database, before the first table
+	for _, statement := range []string{
+		"PRAGMA auto_vacuum = INCREMENTAL",
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA synchronous = NORMAL",
+		sqliteSchema,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, fmt.Errorf("sqlite: cannot initialize %s: %s", route.Address, err)
+		}
+	}
+
+	s := &sqliteSink{
+		db:        db,
+		maxBytes:  int64(getIntParameter(route.Options, "sqlite.maxsize", 512)) * 1024 * 1024,
+		retention: getDurationParameter(route.Options, "sqlite.retention", 7*24*time.Hour),
+	}
+	debug("sqlite: archive:", route.Address, "max bytes:", s.maxBytes, "retention:", s.retention)
+	go s.run()
+
+	adapter := newAdapter(route)
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Insert the batch in a single transaction
+func (s *sqliteSink) send(buffer []*map[string]interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error on begin: %s", err)
+	}
+
+	statement, err := tx.Prepare(`INSERT INTO events
+		(time, container_id, container, stack, service, event) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error on prepare: %s", err)
+	}
+	defer statement.Close()
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		timestamp := time.Now()
+		if t, ok := (*data)["@timestamp"].(time.Time); ok {
+			timestamp = t
+		}
+
+		meta := newTemplateData(*data)
+		if _, err := statement.Exec(timestamp.UnixNano(), meta.ContainerID, meta.Container,
+			meta.Stack, meta.Service, string(event)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error on insert: %s", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error on commit: %s", err)
+	}
+
+	return nil
+}
+
+// Enforce the retention and size cap every interval, away from the
+// concurrent deliveries of the batches
+func (s *sqliteSink) run() {
+	for range time.Tick(sqliteMaintenanceInterval) {
+		s.maintain()
+	}
+}
+
+// Delete the events older than the retention, then the oldest events until
+// the database fits its size cap, and give the free pages back
+func (s *sqliteSink) maintain() {
+	cutoff := time.Now().Add(-s.retention).UnixNano()
+	if _, err := s.db.Exec("DELETE FROM events WHERE time < ?", cutoff); err != nil {
+		debug("sqlite: error on retention:", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if s.size() <= s.maxBytes {
+			break
+		}
+
+		// Drop a tenth of the events at a time
+		if _, err := s.db.Exec(`DELETE FROM events WHERE id <= (SELECT MIN(id) FROM events) +
+			(SELECT COUNT(*) FROM events) / 10`); err != nil {
+			debug("sqlite: error on size cap:", err)
+			break
+		}
+		s.vacuum()
+	}
+
+	s.vacuum()
+}
+
+// Size of the database in use, without its free pages
+func (s *sqliteSink) size() int64 {
+	var pages, free, pageSize int64
+	s.db.QueryRow("PRAGMA page_count").Scan(&pages)
+	s.db.QueryRow("PRAGMA freelist_count").Scan(&free)
+	s.db.QueryRow("PRAGMA page_size").Scan(&pageSize)
+
+	return (pages - free) * pageSize
+}
+
+func (s *sqliteSink) vacuum() {
+	if _, err := s.db.Exec("PRAGMA incremental_vacuum"); err != nil {
+		debug("sqlite: error on vacuum:", err)
+	}
+}
@@ -0,0 +1,268 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Limits of SQS messages and SNS notifications, and of their batch calls
+const (
+	awsMaxMessageBytes = 256 * 1024
+	awsMaxBatchEntries = 10
+)
+
+// sqsSink sends events to an SQS queue, a FIFO queue getting the messages
+// of a container in order
+type sqsSink struct {
+	client   *sqs.SQS
+	queueUrl string
+	fifo     bool
+	drop     func(data *map[string]interface{}, reason string)
+}
+
+// snsSink publishes events to an SNS topic
+type snsSink struct {
+	client   *sns.SNS
+	topicArn string
+	drop     func(data *map[string]interface{}, reason string)
+}
+
+// Create an AWS session with the credentials from the environment or the
+// instance profile, in the region of the route or AWS_REGION
+func newAWSSession(region string) (*session.Session, error) {
+	config := aws.NewConfig()
+	if region != "" {
+		config = config.WithRegion(region)
+	}
+
+	return session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}
+
+// NewSQSAdapter creates an adapter sending to
+// sqs://sqs.us-east-1.amazonaws.com/123456789012/queue
+func NewSQSAdapter(route *router.Route) (router.LogAdapter, error) {
+	queueUrl := "https://" + route.Address
+
+	// The region is part of the queue host
+	region := getStringParameter(route.Options, "aws.region", "")
+	host := strings.Split(strings.SplitN(route.Address, "/", 2)[0], ".")
+	if region == "" && len(host) > 2 && host[0] == "sqs" {
+		region = host[1]
+	}
+
+	sess, err := newAWSSession(region)
+	if err != nil {
+		return nil, fmt.Errorf("sqs: cannot create session: %s", err)
+	}
+	debug("sqs: queue:", queueUrl)
+
+	adapter := newAdapter(route)
+	adapter.sink = &sqsSink{
+		client:   sqs.New(sess),
+		queueUrl: queueUrl,
+		fifo:     strings.HasSuffix(queueUrl, ".fifo"),
+		drop:     adapter.dropEvent,
+	}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// NewSNSAdapter creates an adapter publishing to
+// sns://arn:aws:sns:us-east-1:123456789012:topic
+func NewSNSAdapter(route *router.Route) (router.LogAdapter, error) {
+	topicArn, err := arn.Parse(route.Address)
+	if err != nil {
+		return nil, fmt.Errorf("sns: address must be a topic ARN: %s", err)
+	}
+
+	sess, err := newAWSSession(getStringParameter(route.Options, "aws.region", topicArn.Region))
+	if err != nil {
+		return nil, fmt.Errorf("sns: cannot create session: %s", err)
+	}
+	debug("sns: topic:", route.Address)
+
+	adapter := newAdapter(route)
+	adapter.sink = &snsSink{client: sns.New(sess), topicArn: route.Address, drop: adapter.dropEvent}
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Pack the events of a batch into JSON arrays of at most maxBytes, an
+// event larger than maxBytes on its own is dropped
+func packEvents(buffer []*map[string]interface{}, maxBytes int,
+	drop func(data *map[string]interface{}, reason string)) ([][]byte, error) {
+	var packed [][]byte
+	current := new(bytes.Buffer)
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		if len(event)+2 > maxBytes {
+			drop(data, dropOversized)
+			continue
+		}
+
+		// Close the current array when the event doesn't fit in it
+		if current.Len() > 0 && current.Len()+len(event)+2 > maxBytes {
+			current.WriteByte(']')
+			packed = append(packed, current.Bytes())
+			current = new(bytes.Buffer)
+		}
+
+		if current.Len() == 0 {
+			current.WriteByte('[')
+		} else {
+			current.WriteByte(',')
+		}
+		current.Write(event)
+	}
+
+	if current.Len() > 0 {
+		current.WriteByte(']')
+		packed = append(packed, current.Bytes())
+	}
+
+	return packed, nil
+}
+
+// Group messages into batch calls of at most awsMaxBatchEntries entries
+// and awsMaxMessageBytes in total
+func batchMessages(messages [][]byte) [][][]byte {
+	var batches [][][]byte
+	var current [][]byte
+	size := 0
+
+	for _, message := range messages {
+		if len(current) == awsMaxBatchEntries || size+len(message) > awsMaxMessageBytes {
+			batches = append(batches, current)
+			current, size = nil, 0
+		}
+		current = append(current, message)
+		size += len(message)
+	}
+
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+
+	return batches
+}
+
+// Send the batch as messages holding JSON arrays of events, to a FIFO
+// queue the events of a container are packed apart, grouped by container
+// and deduplicated by content
+func (s *sqsSink) send(buffer []*map[string]interface{}) error {
+	var messages [][]byte
+	var groups []string
+
+	if s.fifo {
+		byContainer := make(map[string][]*map[string]interface{})
+		for _, data := range buffer {
+			group := newTemplateData(*data).ContainerID
+			if group == "" {
+				group = "logspout"
+			}
+			if _, ok := byContainer[group]; !ok {
+				groups = append(groups, group)
+			}
+			byContainer[group] = append(byContainer[group], data)
+		}
+
+		var ordered []string
+		for _, group := range groups {
+			packed, err := packEvents(byContainer[group], awsMaxMessageBytes, s.drop)
+			if err != nil {
+				return err
+			}
+			for _, message := range packed {
+				messages = append(messages, message)
+				ordered = append(ordered, group)
+			}
+		}
+		groups = ordered
+	} else {
+		var err error
+		if messages, err = packEvents(buffer, awsMaxMessageBytes, s.drop); err != nil {
+			return err
+		}
+	}
+
+	sent := 0
+	for _, batch := range batchMessages(messages) {
+		input := &sqs.SendMessageBatchInput{QueueUrl: aws.String(s.queueUrl)}
+		for i, message := range batch {
+			entry := &sqs.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(i)),
+				MessageBody: aws.String(string(message)),
+			}
+			if s.fifo {
+				digest := sha256.Sum256(message)
+				entry.MessageGroupId = aws.String(groups[sent+i])
+				entry.MessageDeduplicationId = aws.String(hex.EncodeToString(digest[:]))
+			}
+			input.Entries = append(input.Entries, entry)
+		}
+		sent += len(batch)
+
+		output, err := s.client.SendMessageBatch(input)
+		if err != nil {
+			return fmt.Errorf("error on SendMessageBatch: %s", err)
+		}
+		if len(output.Failed) > 0 {
+			return fmt.Errorf("SendMessageBatch failed for %d messages: %s",
+				len(output.Failed), aws.StringValue(output.Failed[0].Message))
+		}
+	}
+
+	return nil
+}
+
+// Publish the batch as notifications holding JSON arrays of events
+func (s *snsSink) send(buffer []*map[string]interface{}) error {
+	messages, err := packEvents(buffer, awsMaxMessageBytes, s.drop)
+	if err != nil {
+		return err
+	}
+
+	for _, batch := range batchMessages(messages) {
+		input := &sns.PublishBatchInput{TopicArn: aws.String(s.topicArn)}
+		for i, message := range batch {
+			input.PublishBatchRequestEntries = append(input.PublishBatchRequestEntries,
+				&sns.PublishBatchRequestEntry{
+					Id:      aws.String(strconv.Itoa(i)),
+					Message: aws.String(string(message)),
+				})
+		}
+
+		output, err := s.client.PublishBatch(input)
+		if err != nil {
+			return fmt.Errorf("error on PublishBatch: %s", err)
+		}
+		if len(output.Failed) > 0 {
+			return fmt.Errorf("PublishBatch failed for %d messages: %s",
+				len(output.Failed), aws.StringValue(output.Failed[0].Message))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package logspoutRancher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Container resource usage for event data
+type ResourceUsage struct {
+	CPUPercent    float64 `json:"cpuPercent"`
+	MemoryUsage   uint64  `json:"memoryUsage"`
+	MemoryLimit   uint64  `json:"memoryLimit"`
+	MemoryPercent float64 `json:"memoryPercent"`
+	RestartCount  int     `json:"restartCount"`
+}
+
+// Sample the resource usage of every running container each interval
+func (a *HTTPAdapter) sampleStats(interval time.Duration) {
+	for range time.Tick(interval) {
+		containers, err := a.docker.ListContainers(docker.ListContainersOptions{})
+		if err != nil {
+			debug("http: stats: cannot list containers:", err)
+			continue
+		}
+
+		for _, c := range containers {
+			a.queueStatsEvent(c.ID, interval)
+		}
+	}
+}
+
+func (a *HTTPAdapter) queueStatsEvent(id string, timeout time.Duration) {
+	container, err := a.docker.InspectContainer(id)
+	if err != nil {
+		debug("http: stats: cannot inspect container:", err, id)
+		return
+	}
+
+	stats, err := a.containerStats(id, timeout)
+	if err != nil {
+		debug("http: stats: cannot get container stats:", err, id)
+		return
+	}
+
+	usage := ResourceUsage{
+		CPUPercent:   cpuPercent(stats),
+		MemoryUsage:  stats.MemoryStats.Usage,
+		MemoryLimit:  stats.MemoryStats.Limit,
+		RestartCount: container.RestartCount,
+	}
+	if usage.MemoryLimit > 0 {
+		usage.MemoryPercent = float64(usage.MemoryUsage) / float64(usage.MemoryLimit) * 100
+	}
+
+	data := map[string]interface{}{
+		a.parser.messageKey: fmt.Sprintf("container %s resource usage", container.Name),
+		"metric":            usage,
+	}
+
+	if !a.enrich(data, container) {
+		return
+	}
+
+	a.queue <- &data
+}
+
+// Get a single stats sample of a container
+func (a *HTTPAdapter) containerStats(id string, timeout time.Duration) (*docker.Stats, error) {
+	statsC := make(chan *docker.Stats)
+	errC := make(chan error, 1)
+
+	go func() {
+		errC <- a.docker.Stats(docker.StatsOptions{
+			ID:      id,
+			Stats:   statsC,
+			Stream:  false,
+			Timeout: timeout,
+		})
+	}()
+
+	// The channel is closed once the sample has been sent
+	var stats *docker.Stats
+	for s := range statsC {
+		stats = s
+	}
+
+	if err := <-errC; err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		return nil, fmt.Errorf("no stats for container %s", id)
+	}
+
+	return stats, nil
+}
+
+// CPU usage since the previous sample, as the docker CLI computes it
+func cpuPercent(stats *docker.Stats) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	return cpuDelta / systemDelta * cpus * 100
+}
@@ -0,0 +1,124 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsD packets are kept under the usual network MTU
+const statsdMaxPacketBytes = 1432
+
+// Characters replaced in the components of graphite metric names
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// statsdEmitter aggregates counters and sends them to a StatsD or DogStatsD
+// address every interval
+type statsdEmitter struct {
+	conn      net.Conn
+	prefix    string
+	dogstatsd bool
+	counters  map[statsdMetric]int64
+	mutex     sync.Mutex
+}
+
+// A counter, by name and DogStatsD tags
+type statsdMetric struct {
+	name string
+	tags string
+}
+
+// Create an emitter sending to a host:port over UDP
+func newStatsdEmitter(address string, prefix string, dogstatsd bool) (*statsdEmitter, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statsdEmitter{
+		conn:      conn,
+		prefix:    prefix,
+		dogstatsd: dogstatsd,
+		counters:  make(map[statsdMetric]int64),
+	}, nil
+}
+
+// Add to a counter, the tags become DogStatsD tags or components of the
+// graphite name, e.g. logspout.lines.stack.service.level
+func (s *statsdEmitter) count(name string, n int64, tags ...string) {
+	if s == nil {
+		return
+	}
+
+	metric := statsdMetric{name: s.prefix + "." + name}
+	if s.dogstatsd {
+		pairs := make([]string, 0, len(tags)/2)
+		for i := 0; i+1 < len(tags); i += 2 {
+			pairs = append(pairs, tags[i]+":"+tags[i+1])
+		}
+		metric.tags = strings.Join(pairs, ",")
+	} else {
+		for i := 1; i < len(tags); i += 2 {
+			component := invalidMetricChars.ReplaceAllString(tags[i], "_")
+			if component == "" {
+				component = "none"
+			}
+			metric.name += "." + component
+		}
+	}
+
+	s.mutex.Lock()
+	s.counters[metric] += n
+	s.mutex.Unlock()
+}
+
+// Send the counters every interval
+func (s *statsdEmitter) run(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.flush()
+	}
+}
+
+func (s *statsdEmitter) flush() {
+	s.mutex.Lock()
+	counters := s.counters
+	s.counters = make(map[statsdMetric]int64)
+	s.mutex.Unlock()
+
+	lines := make([]string, 0, len(counters))
+	for metric, n := range counters {
+		line := fmt.Sprintf("%s:%d|c", metric.name, n)
+		if metric.tags != "" {
+			line += "|#" + metric.tags
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	// Pack the lines in as few packets as possible
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsdMaxPacketBytes {
+			s.write(packet.Bytes())
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		s.write(packet.Bytes())
+	}
+}
+
+func (s *statsdEmitter) write(packet []byte) {
+	if _, err := s.conn.Write(packet); err != nil {
+		debug("http: statsd:", err)
+	}
+}
@@ -0,0 +1,85 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// sumoFormat posts events to a Sumo Logic hosted collector, with the source
+// category, name and host of each request rendered from their metadata
+type sumoFormat struct {
+	url      string
+	category *template.Template
+	name     *template.Template
+	host     *template.Template
+}
+
+// NewSumoAdapter creates an adapter posting to the HTTP source of a hosted
+// collector, e.g. sumo://endpoint1.collection.sumologic.com/receiver/v1/http/TOKEN
+func NewSumoAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newHTTPAdapter(route)
+	format := &sumoFormat{
+		url: adapter.url,
+		category: parseTemplate("sumo.category", getStringParameter(route.Options,
+			"sumo.category", "{{.Stack}}/{{.Service}}")),
+		name: parseTemplate("sumo.name", getStringParameter(route.Options, "sumo.name", "{{.Container}}")),
+		host: parseTemplate("sumo.host", getStringParameter(route.Options, "sumo.host", "{{.Hostname}}")),
+	}
+	debug("sumo: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as one request of JSON lines per source category, name
+// and host, as the X-Sumo headers apply to a whole request
+func (f *sumoFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	bodies := make(map[[3]string]*bytes.Buffer)
+	var sources [][3]string
+
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+
+		source := [3]string{
+			renderTemplate(f.category, *data),
+			renderTemplate(f.name, *data),
+			renderTemplate(f.host, *data),
+		}
+		body, ok := bodies[source]
+		if !ok {
+			body = new(bytes.Buffer)
+			bodies[source] = body
+			sources = append(sources, source)
+		}
+		body.Write(event)
+		body.WriteByte('\n')
+	}
+
+	payloads := make([]*httpPayload, 0, len(sources))
+	for _, source := range sources {
+		header := http.Header{}
+		for i, name := range []string{"X-Sumo-Category", "X-Sumo-Name", "X-Sumo-Host"} {
+			if source[i] != "" {
+				header.Set(name, source[i])
+			}
+		}
+		payloads = append(payloads, &httpPayload{
+			url:         f.url,
+			contentType: "application/json",
+			header:      header,
+			body:        bodies[source].Bytes(),
+		})
+	}
+
+	return payloads, nil
+}
@@ -0,0 +1,133 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Characters not allowed in the header fields of RFC5424 messages
+var invalidSyslogChars = regexp.MustCompile(`[^!-~]+`)
+
+// Escapes of the structured data parameter values
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogEncoder formats events as RFC5424 messages, the Rancher metadata of
+// the container being a structured data element
+type syslogEncoder struct {
+	network    string
+	facility   int
+	appName    *template.Template
+	sdId       string
+	messageKey string
+	levelKey   string
+	hostname   string
+}
+
+// NewSyslogAdapter creates an adapter writing RFC5424 messages to a socket,
+// e.g. syslog+udp://siem:514, syslog+tcp://siem:601 or syslog+tls://siem:6514
+func NewSyslogAdapter(route *router.Route) (router.LogAdapter, error) {
+	network := route.AdapterTransport("udp")
+	if network != "tcp" && network != "udp" && network != "tls" {
+		return nil, fmt.Errorf("syslog: unsupported transport: %s", network)
+	}
+
+	adapter := newAdapter(route)
+	hostname, _ := os.Hostname()
+	e := &syslogEncoder{
+		network:    network,
+		facility:   getIntParameter(route.Options, "syslog.facility", 1),
+		appName:    parseTemplate("syslog.appname", getStringParameter(route.Options, "syslog.appname", "{{.Stack}}/{{.Service}}")),
+		sdId:       getStringParameter(route.Options, "syslog.sd_id", "rancher@32473"),
+		messageKey: adapter.parser.messageKey,
+		levelKey:   getStringParameter(route.Options, "syslog.level_key", "level"),
+		hostname:   hostname,
+	}
+
+	adapter.sink = newSocketSink("syslog", network, route.Address,
+		getDurationParameter(route.Options, "syslog.timeout", 10*time.Second), e.encode)
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Truncate a header field to its maximum length, "-" when it is empty
+func syslogHeader(value string, max int) string {
+	value = invalidSyslogChars.ReplaceAllString(value, "_")
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+// Encode an event as an RFC5424 message, octet counted over TCP and TLS
+func (e *syslogEncoder) encode(data *map[string]interface{}) ([]byte, error) {
+	timestamp := time.Now()
+	if t, ok := (*data)["@timestamp"].(time.Time); ok {
+		timestamp = t
+	}
+	severity, ok := journalPriorities[lineLevel(*data, e.levelKey, e.messageKey)]
+	if !ok {
+		severity = 6
+	}
+
+	meta := newTemplateData(*data)
+	hostname := meta.Hostname
+	if hostname == "" {
+		hostname = e.hostname
+	}
+	procId := meta.ContainerID
+	if len(procId) > 12 {
+		procId = procId[:12]
+	}
+
+	// The message, or the whole event when it has none
+	message, ok := (*data)[e.messageKey].(string)
+	if !ok {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		message = string(event)
+	}
+
+	var params []string
+	for _, param := range [][2]string{
+		{"stack", meta.Stack}, {"service", meta.Service}, {"container", meta.Container},
+		{"containerId", meta.ContainerID}, {"image", meta.Image},
+	} {
+		if param[1] != "" {
+			params = append(params, fmt.Sprintf(`%s="%s"`, param[0], syslogParamEscaper.Replace(param[1])))
+		}
+	}
+	structuredData := "-"
+	if len(params) > 0 {
+		structuredData = fmt.Sprintf("[%s %s]", e.sdId, strings.Join(params, " "))
+	}
+
+	line := fmt.Sprintf("<%d>1 %s %s %s %s - %s %s",
+		e.facility*8+severity,
+		timestamp.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(hostname, 255),
+		syslogHeader(renderTemplate(e.appName, *data), 48),
+		syslogHeader(procId, 128),
+		structuredData,
+		message)
+
+	if e.network == "udp" {
+		return []byte(line), nil
+	}
+
+	return []byte(strconv.Itoa(len(line)) + " " + line), nil
+}
@@ -0,0 +1,104 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+)
+
+// Metadata of an event available to the route templates, e.g.
+// {{.Stack}}.{{.Service}}
+type templateData struct {
+	Stack       string
+	Service     string
+	Container   string
+	ContainerID string
+	Image       string
+	Hostname    string
+	Event       map[string]interface{}
+}
+
+// Gather the template metadata of an enriched event, the stack and service
+// come from rancher, then swarm, compose or kubernetes, and default to
+// standalone and the container name
+func newTemplateData(data map[string]interface{}) *templateData {
+	t := &templateData{Event: data}
+
+	if info, ok := data["docker"].(DockerInfo); ok || decoded(data["docker"], &info) {
+		t.Container = strings.TrimPrefix(info.Name, "/")
+		t.ContainerID = info.ID
+		t.Image = info.Image
+		t.Hostname = info.Hostname
+	}
+	// The ECS sections replace the docker one, with the docker section still
+	// there they are fields of the application and must not be trusted
+	_, enriched := data["docker"]
+	if info, ok := data["container"].(*ecsContainer); !enriched && (ok || decoded(data["container"], &info)) &&
+		info.ID != "" {
+		t.Container, t.ContainerID, t.Image = info.Name, info.ID, info.Image.Name
+		if host, ok := data["host"].(map[string]string); ok {
+			t.Hostname = host["hostname"]
+		} else if host, ok := data["host"].(map[string]interface{}); ok {
+			t.Hostname, _ = host["hostname"].(string)
+		}
+	}
+
+	if info, ok := data["rancher"].(*RancherInfo); (ok || decoded(data["rancher"], &info)) && info.Stack != nil {
+		t.Stack, t.Service = info.Stack.StackName, info.Stack.Service
+	}
+	if info, ok := data["swarm"].(*SwarmInfo); (ok || decoded(data["swarm"], &info)) && t.Stack == "" {
+		t.Stack, t.Service = info.Stack, info.Service
+	}
+	if info, ok := data["compose"].(*ComposeInfo); (ok || decoded(data["compose"], &info)) && t.Stack == "" {
+		t.Stack, t.Service = info.Project, info.Service
+	}
+	if info, ok := data["kubernetes"].(*KubernetesInfo); (ok || decoded(data["kubernetes"], &info)) && t.Stack == "" {
+		t.Stack, t.Service = info.Namespace, info.Container
+	}
+
+	if t.Stack == "" {
+		t.Stack = "standalone"
+	}
+	if t.Service == "" {
+		t.Service = t.Container
+	}
+
+	return t
+}
+
+// Decode metadata read back from JSON, by a spool or a dead-letter replay,
+// into its type; false when the value is not a decoded object
+func decoded(value interface{}, info interface{}) bool {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return false
+	}
+
+	return json.Unmarshal(raw, info) == nil
+}
+
+// Parse a template from a route option
+func parseTemplate(name string, text string) *template.Template {
+	t, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		die("", "http: cannot parse template:", name, err)
+	}
+
+	return t
+}
+
+// Render a template with the metadata of an event
+func renderTemplate(t *template.Template, data map[string]interface{}) string {
+	var out bytes.Buffer
+	if err := t.Execute(&out, newTemplateData(data)); err != nil {
+		debug("http: cannot render template:", t.Name(), err)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,35 @@
+package logspoutRancher
+
+import "testing"
+
+func TestTemplateDataIgnoresApplicationContainer(t *testing.T) {
+	data := map[string]interface{}{
+		"docker":    DockerInfo{Name: "/web-1", ID: "3f4e", Hostname: "node-1"},
+		"container": map[string]interface{}{"id": "spoofed", "name": "evil"},
+		"host":      map[string]interface{}{"hostname": "elsewhere"},
+	}
+
+	meta := newTemplateData(data)
+	if meta.Container != "web-1" || meta.ContainerID != "3f4e" || meta.Hostname != "node-1" {
+		t.Errorf("expected the docker metadata, got container=%q id=%q hostname=%q",
+			meta.Container, meta.ContainerID, meta.Hostname)
+	}
+}
+
+func TestTemplateDataReadsECSContainer(t *testing.T) {
+	for name, data := range map[string]map[string]interface{}{
+		"typed": {
+			"container": &ecsContainer{ID: "3f4e", Name: "web-1"},
+			"host":      map[string]string{"hostname": "node-1"},
+		},
+		"decoded": {
+			"container": map[string]interface{}{"id": "3f4e", "name": "web-1"},
+			"host":      map[string]interface{}{"hostname": "node-1"},
+		},
+	} {
+		meta := newTemplateData(data)
+		if meta.Container != "web-1" || meta.ContainerID != "3f4e" || meta.Hostname != "node-1" {
+			t.Errorf("%s: got container=%q id=%q hostname=%q", name, meta.Container, meta.ContainerID, meta.Hostname)
+		}
+	}
+}
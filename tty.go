@@ -0,0 +1,24 @@
+package logspoutRancher
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ANSI escape sequences: CSI (colors, cursor moves), OSC (window titles) and
+// single character escapes
+var ansiEscape = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// Clean a line written by a container with a TTY: drop the escape sequences
+// and keep what the terminal would display after carriage returns
+func cleanTTYLine(line string) string {
+	line = ansiEscape.ReplaceAllString(line, "")
+	line = strings.TrimRight(line, "\r")
+
+	// Progress bars redraw the line after a carriage return
+	if i := strings.LastIndex(line, "\r"); i >= 0 {
+		line = line[i+1:]
+	}
+
+	return line
+}
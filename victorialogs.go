@@ -0,0 +1,88 @@
+package logspoutRancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// victoriaLogsFormat posts events to the jsonline ingestion endpoint of
+// VictoriaLogs, streamed by stack, service and container
+type victoriaLogsFormat struct {
+	url        string
+	header     http.Header
+	messageKey string
+}
+
+// NewVictoriaLogsAdapter creates an adapter ingesting into VictoriaLogs, e.g.
+// victorialogs://victorialogs:9428
+func NewVictoriaLogsAdapter(route *router.Route) (router.LogAdapter, error) {
+	adapter := newHTTPAdapter(route)
+
+	query := url.Values{}
+	query.Set("_stream_fields", "stack,service,container")
+	format := &victoriaLogsFormat{
+		url:        adapter.url + "/insert/jsonline?" + query.Encode(),
+		header:     http.Header{},
+		messageKey: adapter.parser.messageKey,
+	}
+
+	// Tenant of a multitenant cluster
+	if account := getStringParameter(route.Options, "victorialogs.account", ""); account != "" {
+		format.header.Set("AccountID", account)
+	}
+	if project := getStringParameter(route.Options, "victorialogs.project", ""); project != "" {
+		format.header.Set("ProjectID", project)
+	}
+	debug("victorialogs: url:", format.url)
+
+	adapter.format = format
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Encode the batch as one line per event, the message becomes _msg, the
+// timestamp _time, and the stream fields are added at the top level
+func (f *victoriaLogsFormat) encode(buffer []*map[string]interface{}) ([]*httpPayload, error) {
+	var body bytes.Buffer
+
+	for _, data := range buffer {
+		meta := newTemplateData(*data)
+
+		row := make(map[string]interface{}, len(*data)+3)
+		for k, v := range *data {
+			row[k] = v
+		}
+		row["stack"] = meta.Stack
+		row["service"] = meta.Service
+		row["container"] = meta.Container
+
+		if message, ok := row[f.messageKey]; ok {
+			row["_msg"] = message
+			delete(row, f.messageKey)
+		}
+		if timestamp, ok := row["@timestamp"]; ok {
+			row["_time"] = timestamp
+			delete(row, "@timestamp")
+		}
+
+		event, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding JSON: %s", err)
+		}
+		body.Write(event)
+		body.WriteByte('\n')
+	}
+
+	return []*httpPayload{{
+		url:         f.url,
+		contentType: "application/stream+json",
+		header:      f.header,
+		body:        body.Bytes(),
+	}}, nil
+}
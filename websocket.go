@@ -0,0 +1,117 @@
+package logspoutRancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/gorilla/websocket"
+)
+
+// websocketSink streams events as individual JSON frames on a persistent
+// WebSocket connection, reconnecting when it drops
+type websocketSink struct {
+	url     string
+	header  http.Header
+	timeout time.Duration
+	conn    *websocket.Conn
+	mutex   sync.Mutex
+}
+
+// NewWebSocketAdapter creates an adapter streaming to ws://dashboard:8080/ingest
+// or wss://dashboard/ingest
+func NewWebSocketAdapter(route *router.Route) (router.LogAdapter, error) {
+	s := &websocketSink{
+		url:     route.Adapter + "://" + route.Address,
+		header:  http.Header{},
+		timeout: getDurationParameter(route.Options, "ws.timeout", 10*time.Second),
+	}
+	if authorization := secretParameter(route.Options, "ws.authorization", "WS_AUTHORIZATION"); authorization != "" {
+		s.header.Set("Authorization", authorization)
+	}
+	if err := s.connect(); err != nil {
+		debug("ws: cannot connect, will retry:", err)
+	}
+	debug("ws:", s.url)
+
+	adapter := newAdapter(route)
+	adapter.sink = s
+	adapter.start()
+
+	return adapter, nil
+}
+
+// Connect, the frames sent by the server are read and discarded so the
+// control frames are handled and a closed connection noticed
+func (s *websocketSink) connect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	dialer := &websocket.Dialer{HandshakeTimeout: s.timeout, Proxy: http.ProxyFromEnvironment}
+	conn, _, err := dialer.Dial(s.url, s.header)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				debug("ws: connection closed:", err)
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Write a frame per event, reconnecting once when the connection dropped
+func (s *websocketSink) send(buffer []*map[string]interface{}) error {
+	var frames [][]byte
+	for _, data := range buffer {
+		event, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %s", err)
+		}
+		frames = append(frames, event)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				continue
+			}
+		}
+
+		if err = s.write(frames); err == nil {
+			return nil
+		}
+		debug("ws: write failed, reconnecting:", err)
+		s.connect()
+	}
+
+	return fmt.Errorf("cannot write to %s: %s", s.url, err)
+}
+
+func (s *websocketSink) write(frames [][]byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+
+	for _, frame := range frames {
+		if err := s.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}